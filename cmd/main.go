@@ -4,6 +4,8 @@ import (
 	"apubot/internal/app"
 	"apubot/internal/config"
 	"log"
+	"os"
+	_ "time/tzdata" // chat time zones must work in containers without system zone database
 )
 
 func main() {
@@ -12,5 +14,5 @@ func main() {
 		log.Fatal(err)
 	}
 
-	app.New(cfg).Run()
+	os.Exit(app.New(cfg).Run())
 }
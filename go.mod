@@ -3,11 +3,13 @@ module apubot
 go 1.23.3
 
 require (
+	github.com/fsnotify/fsnotify v1.8.0
 	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
 	github.com/golang-migrate/migrate/v4 v4.18.1
 	github.com/joho/godotenv v1.5.1
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/pkg/errors v0.9.1
+	github.com/robfig/cron/v3 v3.0.1
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -16,4 +18,5 @@ require (
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/mattn/go-sqlite3 v1.14.23 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
 )
@@ -8,16 +8,34 @@ import (
 	"apubot/internal/infrastructure/webapi"
 	"apubot/internal/server"
 	"apubot/internal/service"
+	"apubot/pkg/utils/clock"
+	"apubot/pkg/utils/random"
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	ExitOK    = 0
+	ExitError = 1
 )
 
 type App struct {
-	cfg    *config.Config
-	server *server.Server
+	cfg      *config.Config
+	db       *database.DB
+	services *service.Services
+	handlers *handler.Handlers
+	server   *server.Server
 }
 
 func New(cfg *config.Config) *App {
 	webAPI := webapi.New(cfg)
 
+	clk := clock.New()
+
 	db := database.New(cfg)
 
 	repos := repository.New(
@@ -31,6 +49,8 @@ func New(cfg *config.Config) *App {
 		&service.InitParams{
 			Config:       cfg,
 			Repositories: repos,
+			Clock:        clk,
+			Rand:         random.New(time.Now().UnixNano()),
 		},
 	)
 
@@ -38,6 +58,7 @@ func New(cfg *config.Config) *App {
 		&handler.InitParams{
 			Config:   cfg,
 			APIs:     webAPI,
+			Clock:    clk,
 			Services: services,
 		},
 	)
@@ -51,11 +72,83 @@ func New(cfg *config.Config) *App {
 	)
 
 	return &App{
-		cfg:    cfg,
-		server: s,
+		cfg:      cfg,
+		db:       db,
+		services: services,
+		handlers: handlers,
+		server:   s,
+	}
+}
+
+// Run serves updates until the process is asked to stop and returns the exit code.
+func (a *App) Run() int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	code := ExitOK
+
+	err := a.server.Start(ctx)
+	if err != nil {
+		log.Printf("Error serving updates: %v", err)
+
+		code = ExitError
+	}
+
+	// second signal kills the process right away
+	stop()
+
+	if !a.shutdown() {
+		code = ExitError
 	}
+
+	return code
 }
 
-func (a *App) Run() {
-	a.server.Start()
+// shutdown waits for running handlers and their background jobs, then for scheduled sends,
+// and closes db once nothing can write to it.
+// Reports whether everything was stopped in time.
+func (a *App) shutdown() bool {
+	log.Println("Shutting down...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
+	defer cancel()
+
+	ok := true
+
+	err := a.server.Stop(ctx)
+	if err != nil {
+		log.Printf("Error stopping server: %v", err)
+
+		ok = false
+	}
+
+	err = a.handlers.Stop(ctx)
+	if err != nil {
+		log.Printf("Error stopping handlers: %v", err)
+
+		ok = false
+	}
+
+	err = a.services.Stop(ctx)
+	if err != nil {
+		log.Printf("Error stopping services: %v", err)
+
+		ok = false
+	}
+
+	if !ok {
+		// closing db under running writers would only turn their writes into errors
+		return false
+	}
+
+	err = a.db.Close()
+	if err != nil {
+		log.Printf("Error closing database: %v", err)
+
+		return false
+	}
+
+	log.Println("Stopped")
+
+	return true
 }
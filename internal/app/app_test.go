@@ -0,0 +1,242 @@
+package app
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/testutil"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testChatID    = 100
+	blockedChatID = 200
+
+	// presetCallback is the button of the /sub keyboard subscribing to the 30m preset
+	presetCallback = "sub:main:1800"
+
+	callTimeout = 5 * time.Second
+)
+
+func TestMain(m *testing.M) {
+	// migrations are read relative to the working directory, like in the container
+	err := os.Chdir(filepath.Join("..", ".."))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can not change to module root: %v\n", err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+// startApp runs the whole bot against a fake Bot API with a single image in its directory,
+// peepo.png unless another file is given. The bot is stopped when the test ends.
+func startApp(t *testing.T, image ...string) (*App, *testutil.FakeBotAPI) {
+	t.Helper()
+
+	imageName := "peepo.png"
+	if len(image) > 0 {
+		imageName = image[0]
+	}
+
+	fake := testutil.NewFakeBotAPI()
+	t.Cleanup(fake.Close)
+
+	dir := t.TempDir()
+	imagesDir := filepath.Join(dir, "images")
+
+	writeFile(t, filepath.Join(imagesDir, imageName), "not really a "+strings.TrimPrefix(filepath.Ext(imageName), "."))
+	writeFile(t, filepath.Join(dir, "config.yaml"), fmt.Sprintf(`
+api_endpoint: %q
+command_cooldown: 0s
+images_dir_path: %q
+images_watch:
+  mode: "off"
+`, fake.Endpoint(), imagesDir))
+	writeFile(t, filepath.Join(dir, "prod.env"), "api_key="+testutil.FakeBotToken+"\ndb_path=unused.db\n")
+
+	cfg, err := config.NewConfig(dir)
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+
+	// env loaded by an earlier test is not overwritten
+	cfg.ApiKey = testutil.FakeBotToken
+	cfg.DBPath = filepath.Join(dir, "bot.db")
+
+	a := New(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan bool)
+
+	go func() {
+		err := a.server.Start(ctx)
+		if err != nil {
+			t.Errorf("Start: %v", err)
+		}
+
+		stopped <- a.shutdown()
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+
+		if !<-stopped {
+			t.Error("bot was not stopped cleanly")
+		}
+	})
+
+	return a, fake
+}
+
+func writeFile(t *testing.T, name string, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(name), 0o755)
+	if err == nil {
+		err = os.WriteFile(name, []byte(content), 0o644)
+	}
+
+	if err != nil {
+		t.Fatalf("can not write %s: %v", name, err)
+	}
+}
+
+func waitCalls(t *testing.T, fake *testutil.FakeBotAPI, n int, methods ...string) []testutil.Call {
+	t.Helper()
+
+	calls, ok := fake.WaitCalls(n, callTimeout, methods...)
+	if !ok {
+		t.Fatalf("got %d %v call(s), want %d", len(calls), methods, n)
+	}
+
+	return calls
+}
+
+func TestPeepoUploadsOnceThenReusesFileID(t *testing.T) {
+	_, fake := startApp(t)
+
+	fake.PushMessage(testChatID, "/peepo")
+	first := waitCalls(t, fake, 1, "sendPhoto")[0]
+
+	if first.ChatID != testChatID || first.Upload != "peepo.png" || first.FileID == "" {
+		t.Fatalf("first sendPhoto = %+v, want upload of peepo.png to chat %d", first, testChatID)
+	}
+
+	fake.PushMessage(testChatID, "/peepo")
+	second := waitCalls(t, fake, 2, "sendPhoto")[1]
+
+	if second.Upload != "" || second.Params["photo"] != first.FileID {
+		t.Errorf("second sendPhoto = %+v, want file_id %s of the first upload", second, first.FileID)
+	}
+}
+
+func TestPeepoUploadsVideoAgainWhenFileIDIsRefused(t *testing.T) {
+	_, fake := startApp(t, "peepo.mp4")
+
+	fake.PushMessage(testChatID, "/peepo")
+	first := waitCalls(t, fake, 1, "sendVideo")[0]
+
+	if first.Upload != "peepo.mp4" || first.FileID == "" {
+		t.Fatalf("first sendVideo = %+v, want upload of peepo.mp4", first)
+	}
+
+	// like after moving to another Bot API server, which did not issue the id
+	fake.FailNext("sendVideo", http.StatusBadRequest, "Bad Request: wrong file identifier/HTTP URL specified")
+	fake.PushMessage(testChatID, "/peepo")
+	calls := waitCalls(t, fake, 3, "sendVideo")
+
+	if calls[1].Params["video"] != first.FileID || calls[2].Upload != "peepo.mp4" || calls[2].FileID == "" {
+		t.Fatalf("sendVideo calls = %+v, want refused file_id %s followed by an upload", calls[1:], first.FileID)
+	}
+
+	fake.PushMessage(testChatID, "/peepo")
+	last := waitCalls(t, fake, 4, "sendVideo")[3]
+
+	if last.Upload != "" || last.Params["video"] != calls[2].FileID {
+		t.Errorf("last sendVideo = %+v, want file_id %s of the new upload", last, calls[2].FileID)
+	}
+}
+
+func TestPeepoRetriesAfterRateLimit(t *testing.T) {
+	_, fake := startApp(t)
+
+	fake.RateLimitNext("sendPhoto", time.Second)
+	fake.PushMessage(testChatID, "/peepo")
+
+	calls := waitCalls(t, fake, 2, "sendPhoto")
+
+	if calls[0].FileID != "" || calls[1].FileID == "" {
+		t.Errorf("sendPhoto calls = %+v, want rate limited call followed by a successful one", calls)
+	}
+
+	if messages := fake.Calls("sendMessage"); len(messages) > 0 {
+		t.Errorf("unexpected messages sent: %+v", messages)
+	}
+}
+
+func TestSubscribeWithPresetSendsScheduledImage(t *testing.T) {
+	_, fake := startApp(t)
+
+	fake.PushMessage(testChatID, "/sub")
+	keyboard := waitCalls(t, fake, 1, "sendMessage")[0]
+
+	if !strings.Contains(keyboard.Params["reply_markup"], presetCallback) {
+		t.Fatalf("/sub keyboard = %s, want %s button", keyboard.Params["reply_markup"], presetCallback)
+	}
+
+	fake.PushCallback(testChatID, 1, presetCallback)
+
+	edit := waitCalls(t, fake, 1, "editMessageText")[0]
+	if edit.Params["message_id"] != "1" || !strings.Contains(edit.Params["text"], `Subscription "main" created`) {
+		t.Errorf("editMessageText = %+v, want keyboard message replaced by the result", edit)
+	}
+
+	waitCalls(t, fake, 1, "answerCallbackQuery")
+
+	// first image of a periodic subscription is sent right away by the scheduler
+	sent := waitCalls(t, fake, 1, "sendPhoto")[0]
+	if sent.ChatID != testChatID {
+		t.Errorf("scheduled sendPhoto went to chat %d, want %d", sent.ChatID, testChatID)
+	}
+}
+
+func TestSubscriptionOfBlockedChatIsDeleted(t *testing.T) {
+	a, fake := startApp(t)
+
+	fake.Block(blockedChatID)
+	fake.PushCallback(blockedChatID, 1, presetCallback)
+
+	sent := waitCalls(t, fake, 1, "sendPhoto")[0]
+	if sent.ChatID != blockedChatID || sent.FileID != "" {
+		t.Fatalf("scheduled sendPhoto = %+v, want it refused for chat %d", sent, blockedChatID)
+	}
+
+	deadline := time.Now().Add(callTimeout)
+
+	for {
+		subs, err := a.services.Subscription.List(context.Background(), blockedChatID)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+
+		if len(subs) == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("subscription of blocked chat is kept: %+v", subs)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if sends := fake.Calls("sendPhoto"); len(sends) != 1 {
+		t.Errorf("sendPhoto called %d times, want a single refused call", len(sends))
+	}
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -13,34 +15,153 @@ import (
 const (
 	DefaultCommandCooldown         = time.Second * 5
 	DefaultRequestTimeout          = time.Second * 5
+	DefaultUploadTimeout           = time.Minute
 	DefaultLastSentQueueSize       = 10
 	DefaultMaxRetries              = 3
 	DefaultMinSubscriptionInterval = time.Minute * 15
 	DefaultMaxSubscriptionInterval = time.Hour * 24
+	DefaultMaxSubscriptionsPerChat = 5
+	DefaultWebhookListenAddr       = ":8443"
+	DefaultApiEndpoint             = "https://api.telegram.org/bot%s/%s"
+	DefaultWarmInterval            = time.Second * 3
+	DefaultSchedulerWorkers        = 4
+	DefaultUpdateWorkers           = 8
+	DefaultShutdownTimeout         = time.Second * 30
+	DefaultGlobalSendsPerSecond    = 30
+	DefaultChatSendInterval        = time.Second
+	DefaultGroupChatSendInterval   = time.Second * 3
+	DefaultRateLimitMaxRetries     = 5
+	DefaultImagesRescanInterval    = time.Minute
+	DefaultDialogTimeout           = time.Minute * 5
 )
 
+// DefaultSubscriptionPresets are periods offered by the /sub keyboard.
+var DefaultSubscriptionPresets = []time.Duration{
+	time.Minute * 30,
+	time.Hour,
+	time.Hour * 3,
+	time.Hour * 6,
+	time.Hour * 12,
+	time.Hour * 24,
+}
+
+const (
+	ImagesWatchModeOff     = "off"
+	ImagesWatchModeInotify = "inotify"
+	ImagesWatchModeRescan  = "rescan"
+)
+
+const (
+	DialogStorageMemory = "memory"
+	DialogStorageSQLite = "sqlite"
+)
+
+const (
+	UpdatesModePolling = "polling"
+	UpdatesModeWebhook = "webhook"
+)
+
+// LocalBotAPIConfig describes a self-hosted telegram-bot-api server started with --local,
+// it reads uploaded files right from its file system instead of receiving them over HTTP.
+type LocalBotAPIConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	ImagesDirPath string `yaml:"images_dir_path"` // images directory as seen by the server, absolute
+}
+
+// WarmConfig describes uploading of images to a storage chat, so telegram ids are known before the first send.
+type WarmConfig struct {
+	StorageChatID int64         `yaml:"storage_chat_id"`
+	Interval      time.Duration `yaml:"interval"`
+}
+
+type ImagesWatchConfig struct {
+	Mode     string        `yaml:"mode"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+type RateLimitConfig struct {
+	GlobalPerSecond   int           `yaml:"global_per_second"`
+	ChatInterval      time.Duration `yaml:"chat_interval"`
+	GroupChatInterval time.Duration `yaml:"group_chat_interval"`
+	MaxRetries        int           `yaml:"max_retries"`
+}
+
+type DialogConfig struct {
+	Timeout time.Duration `yaml:"timeout"`
+	Storage string        `yaml:"storage"`
+}
+
+type WebhookConfig struct {
+	URL         string `yaml:"url"`
+	ListenAddr  string `yaml:"listen_addr"`
+	SecretToken string `yaml:"-"`
+}
+
 type Config struct {
-	IsDebug                 bool          `yaml:"is_debug"`
-	ApiKey                  string        `yaml:"api_key"`
-	DBPath                  string        `yaml:"db_path"`
-	CommandCooldown         time.Duration `yaml:"command_cooldown"`
-	ImagesDirPath           string        `yaml:"images_dir_path"`
-	RequestTimeout          time.Duration `yaml:"request_timeout"`
-	LastSentQueueSize       int           `yaml:"last_sent_queue_size"`
-	MaxRetries              int           `yaml:"max_retries"`
-	MinSubscriptionInterval time.Duration `yaml:"min_subscription_interval"`
-	MaxSubscriptionInterval time.Duration `yaml:"max_subscription_interval"`
+	IsDebug                 bool              `yaml:"is_debug"`
+	ApiKey                  string            `yaml:"api_key"`
+	ApiEndpoint             string            `yaml:"api_endpoint"`
+	LocalBotAPI             LocalBotAPIConfig `yaml:"local_bot_api"`
+	DBPath                  string            `yaml:"db_path"`
+	CommandCooldown         time.Duration     `yaml:"command_cooldown"`
+	AdminIDs                []int64           `yaml:"admin_ids"`
+	ImagesDirPath           string            `yaml:"images_dir_path"`
+	ImagesWatch             ImagesWatchConfig `yaml:"images_watch"`
+	RequestTimeout          time.Duration     `yaml:"request_timeout"`
+	UploadTimeout           time.Duration     `yaml:"upload_timeout"`
+	LastSentQueueSize       int               `yaml:"last_sent_queue_size"`
+	MaxRetries              int               `yaml:"max_retries"`
+	MinSubscriptionInterval time.Duration     `yaml:"min_subscription_interval"`
+	MaxSubscriptionInterval time.Duration     `yaml:"max_subscription_interval"`
+	MaxSubscriptionsPerChat int               `yaml:"max_subscriptions_per_chat"`
+	SubscriptionPresets     []time.Duration   `yaml:"subscription_presets"`
+	SchedulerWorkers        int               `yaml:"scheduler_workers"`
+	UpdateWorkers           int               `yaml:"update_workers"`
+	ShutdownTimeout         time.Duration     `yaml:"shutdown_timeout"`
+	RateLimit               RateLimitConfig   `yaml:"rate_limit"`
+	Dialog                  DialogConfig      `yaml:"dialog"`
+	Warm                    WarmConfig        `yaml:"warm"`
+	UpdatesMode             string            `yaml:"updates_mode"`
+	Webhook                 WebhookConfig     `yaml:"webhook"`
 }
 
 func NewConfig(cfgFolderPath string) (*Config, error) {
 	c := &Config{
 		IsDebug:                 false,
+		ApiEndpoint:             DefaultApiEndpoint,
 		CommandCooldown:         DefaultCommandCooldown,
 		RequestTimeout:          DefaultRequestTimeout,
+		UploadTimeout:           DefaultUploadTimeout,
 		LastSentQueueSize:       DefaultLastSentQueueSize,
 		MaxRetries:              DefaultMaxRetries,
 		MinSubscriptionInterval: DefaultMinSubscriptionInterval,
 		MaxSubscriptionInterval: DefaultMaxSubscriptionInterval,
+		MaxSubscriptionsPerChat: DefaultMaxSubscriptionsPerChat,
+		SubscriptionPresets:     DefaultSubscriptionPresets,
+		ImagesWatch: ImagesWatchConfig{
+			Mode:     ImagesWatchModeRescan,
+			Interval: DefaultImagesRescanInterval,
+		},
+		SchedulerWorkers: DefaultSchedulerWorkers,
+		UpdateWorkers:    DefaultUpdateWorkers,
+		ShutdownTimeout:  DefaultShutdownTimeout,
+		RateLimit: RateLimitConfig{
+			GlobalPerSecond:   DefaultGlobalSendsPerSecond,
+			ChatInterval:      DefaultChatSendInterval,
+			GroupChatInterval: DefaultGroupChatSendInterval,
+			MaxRetries:        DefaultRateLimitMaxRetries,
+		},
+		Dialog: DialogConfig{
+			Timeout: DefaultDialogTimeout,
+			Storage: DialogStorageMemory,
+		},
+		Warm: WarmConfig{
+			Interval: DefaultWarmInterval,
+		},
+		UpdatesMode: UpdatesModePolling,
+		Webhook: WebhookConfig{
+			ListenAddr: DefaultWebhookListenAddr,
+		},
 	}
 
 	cfgPath := path.Join(cfgFolderPath, "config.yaml")
@@ -52,6 +173,16 @@ func NewConfig(cfgFolderPath string) (*Config, error) {
 		return nil, err
 	}
 
+	// by default the server shares file system with the bot
+	if c.LocalBotAPI.Enabled && c.LocalBotAPI.ImagesDirPath == "" {
+		c.LocalBotAPI.ImagesDirPath, err = filepath.Abs(c.ImagesDirPath)
+		if err != nil {
+			err = errors.Wrap(err, "NewConfig")
+
+			return nil, err
+		}
+	}
+
 	c.MaxSubscriptionInterval = c.MaxSubscriptionInterval.Round(time.Second)
 	c.MinSubscriptionInterval = c.MinSubscriptionInterval.Round(time.Second)
 
@@ -106,6 +237,7 @@ func (c *Config) loadEnv(filePath string) error {
 
 	c.ApiKey = os.Getenv("api_key")
 	c.DBPath = os.Getenv("db_path")
+	c.Webhook.SecretToken = os.Getenv("webhook_secret")
 
 	return nil
 }
@@ -117,6 +249,26 @@ func (c *Config) validate() error {
 		return err
 	}
 
+	if strings.Count(c.ApiEndpoint, "%s") != 2 {
+		err := errors.New("api_endpoint must contain %s placeholders for token and method")
+
+		return err
+	}
+
+	if c.LocalBotAPI.Enabled {
+		if c.ApiEndpoint == DefaultApiEndpoint {
+			err := errors.New("api_endpoint of self-hosted server is required for local_bot_api")
+
+			return err
+		}
+
+		if !filepath.IsAbs(c.LocalBotAPI.ImagesDirPath) {
+			err := errors.New("local_bot_api.images_dir_path must be absolute")
+
+			return err
+		}
+	}
+
 	if c.DBPath == "" {
 		err := errors.New("db_path is required")
 
@@ -129,5 +281,101 @@ func (c *Config) validate() error {
 		return err
 	}
 
+	switch c.ImagesWatch.Mode {
+	case ImagesWatchModeOff, ImagesWatchModeInotify:
+	case ImagesWatchModeRescan:
+		if c.ImagesWatch.Interval <= 0 {
+			err := errors.New("images_watch.interval must be positive")
+
+			return err
+		}
+	default:
+		err := errors.Errorf("unknown images_watch.mode: %s", c.ImagesWatch.Mode)
+
+		return err
+	}
+
+	for _, preset := range c.SubscriptionPresets {
+		if preset < c.MinSubscriptionInterval || preset > c.MaxSubscriptionInterval {
+			err := errors.Errorf("subscription preset %s is out of subscription interval bounds", preset)
+
+			return err
+		}
+	}
+
+	if c.MaxSubscriptionsPerChat < 1 {
+		err := errors.New("max_subscriptions_per_chat must be positive")
+
+		return err
+	}
+
+	if c.SchedulerWorkers < 1 {
+		err := errors.New("scheduler_workers must be positive")
+
+		return err
+	}
+
+	if c.UpdateWorkers < 1 {
+		err := errors.New("update_workers must be positive")
+
+		return err
+	}
+
+	if c.RequestTimeout <= 0 || c.UploadTimeout <= 0 {
+		err := errors.New("request_timeout and upload_timeout must be positive")
+
+		return err
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		err := errors.New("shutdown_timeout must be positive")
+
+		return err
+	}
+
+	if c.RateLimit.GlobalPerSecond < 1 {
+		err := errors.New("rate_limit.global_per_second must be positive")
+
+		return err
+	}
+
+	if c.Dialog.Timeout <= 0 {
+		err := errors.New("dialog.timeout must be positive")
+
+		return err
+	}
+
+	if c.Dialog.Storage != DialogStorageMemory && c.Dialog.Storage != DialogStorageSQLite {
+		err := errors.Errorf("unknown dialog.storage: %s", c.Dialog.Storage)
+
+		return err
+	}
+
+	if c.Warm.Interval <= 0 {
+		err := errors.New("warm.interval must be positive")
+
+		return err
+	}
+
+	switch c.UpdatesMode {
+	case UpdatesModePolling:
+	case UpdatesModeWebhook:
+		if c.Webhook.URL == "" {
+			err := errors.New("webhook.url is required in webhook mode")
+
+			return err
+		}
+
+		if c.Webhook.SecretToken == "" {
+			err := errors.New("webhook_secret is required in webhook mode")
+
+			return err
+		}
+	default:
+		err := errors.Errorf("unknown updates_mode: %s", c.UpdatesMode)
+
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,124 @@
+package domain
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+const (
+	ChatStatusMember = "member"
+	ChatStatusKicked = "kicked"
+	ChatStatusLeft   = "left"
+)
+
+const (
+	QuietPolicyDefer = "defer" // send once the quiet hours end
+	QuietPolicySkip  = "skip"  // drop events falling into quiet hours
+)
+
+type Chat struct {
+	ChatId     int64
+	Status     string
+	UpdatedAt  int64
+	Timezone   string // IANA zone name, empty means server local time
+	QuietHours QuietHours
+}
+
+// QuietHours is a daily window in chat local time when scheduled pictures are not sent.
+// From and To are minutes since midnight, the window may cross midnight and is disabled when they are equal.
+type QuietHours struct {
+	From   int
+	To     int
+	Policy string
+}
+
+// HasAccess reports whether the bot can send messages to the chat.
+func (c Chat) HasAccess() bool {
+	return c.Status == ChatStatusMember
+}
+
+// Location returns time zone of the chat, server local zone is used when it is not set or unknown.
+func (c Chat) Location() *time.Location {
+	if c.Timezone == "" {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.Local
+	}
+
+	return loc
+}
+
+// ParseQuietHours reads a window like "23:00-08:00".
+func ParseQuietHours(s string, policy string) (QuietHours, error) {
+	rawFrom, rawTo, ok := strings.Cut(s, "-")
+	if !ok {
+		return QuietHours{}, errors.New("quiet hours must look like 23:00-08:00")
+	}
+
+	from, err := time.Parse("15:04", strings.TrimSpace(rawFrom))
+	if err != nil {
+		return QuietHours{}, errors.Errorf("invalid time of day: %s", rawFrom)
+	}
+
+	to, err := time.Parse("15:04", strings.TrimSpace(rawTo))
+	if err != nil {
+		return QuietHours{}, errors.Errorf("invalid time of day: %s", rawTo)
+	}
+
+	if policy != QuietPolicyDefer && policy != QuietPolicySkip {
+		return QuietHours{}, errors.Errorf("unknown quiet hours policy: %s", policy)
+	}
+
+	q := QuietHours{
+		From:   from.Hour()*60 + from.Minute(),
+		To:     to.Hour()*60 + to.Minute(),
+		Policy: policy,
+	}
+
+	if !q.IsEnabled() {
+		return QuietHours{}, errors.New("quiet hours must not start and end at the same time")
+	}
+
+	return q, nil
+}
+
+func (q QuietHours) IsEnabled() bool {
+	return q.From != q.To
+}
+
+// Contains reports whether the time falls into the window, t must be in chat location.
+func (q QuietHours) Contains(t time.Time) bool {
+	if !q.IsEnabled() {
+		return false
+	}
+
+	m := t.Hour()*60 + t.Minute()
+	if q.From < q.To {
+		return m >= q.From && m < q.To
+	}
+
+	return m >= q.From || m < q.To
+}
+
+// End returns the first moment after t when the window is over, t must be in chat location.
+func (q QuietHours) End(t time.Time) time.Time {
+	end := time.Date(t.Year(), t.Month(), t.Day(), q.To/60, q.To%60, 0, 0, t.Location())
+	if !end.After(t) {
+		end = time.Date(t.Year(), t.Month(), t.Day()+1, q.To/60, q.To%60, 0, 0, t.Location())
+	}
+
+	return end
+}
+
+func (q QuietHours) String() string {
+	if !q.IsEnabled() {
+		return "off"
+	}
+
+	return fmt.Sprintf("%02d:%02d-%02d:%02d (%s)", q.From/60, q.From%60, q.To/60, q.To%60, q.Policy)
+}
@@ -0,0 +1,12 @@
+package domain
+
+// DialogStateSubscriptionInput waits for a period or schedule of the subscription being created.
+const DialogStateSubscriptionInput = "subscription_input"
+
+// DialogSession is a multi-step conversation with the chat, Data keeps values collected by previous steps.
+type DialogSession struct {
+	ChatId    int64
+	State     string
+	Data      map[string]string
+	ExpiresAt int64
+}
@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+)
+
+const FilterAll = "all"
+
+// CategoryFilter limits images to selected categories.
+// Empty Include means every category except excluded ones.
+type CategoryFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// ParseCategoryFilter reads filter from tokens like "happy +sad -seasonal",
+// a minus sign excludes the category, "all" resets the filter.
+func ParseCategoryFilter(tokens []string) CategoryFilter {
+	var f CategoryFilter
+
+	for _, token := range tokens {
+		token = strings.ToLower(strings.Trim(token, ", "))
+
+		switch {
+		case token == "" || token == FilterAll:
+		case strings.HasPrefix(token, "-"):
+			f.Exclude = appendUnique(f.Exclude, strings.TrimPrefix(token, "-"))
+		default:
+			f.Include = appendUnique(f.Include, strings.TrimPrefix(token, "+"))
+		}
+	}
+
+	return f
+}
+
+func appendUnique(s []string, v string) []string {
+	if v == "" || slices.Contains(s, v) {
+		return s
+	}
+
+	return append(s, v)
+}
+
+func (f CategoryFilter) IsEmpty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+func (f CategoryFilter) Matches(category string) bool {
+	if slices.Contains(f.Exclude, category) {
+		return false
+	}
+
+	return len(f.Include) == 0 || slices.Contains(f.Include, category)
+}
+
+// Categories returns every category mentioned in the filter.
+func (f CategoryFilter) Categories() []string {
+	return append(slices.Clone(f.Include), f.Exclude...)
+}
+
+func (f CategoryFilter) String() string {
+	if f.IsEmpty() {
+		return FilterAll
+	}
+
+	var parts []string
+
+	if len(f.Include) > 0 {
+		parts = append(parts, "only "+strings.Join(f.Include, ", "))
+	}
+
+	if len(f.Exclude) > 0 {
+		parts = append(parts, "except "+strings.Join(f.Exclude, ", "))
+	}
+
+	return strings.Join(parts, "; ")
+}
@@ -1,6 +1,7 @@
 package domain
 
 type File struct {
-	Name string
-	TgID string
+	Name     string // path relative to images directory
+	TgID     string
+	Category string // name of the subdirectory, empty for files in the root
 }
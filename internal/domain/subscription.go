@@ -1,11 +1,26 @@
 package domain
 
-import "time"
+import (
+	"apubot/pkg/utils/schedule"
+	"regexp"
+	"time"
+)
+
+const DefaultSubscriptionName = "main"
+
+var subscriptionNameRe = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
 
 type Subscription struct {
+	Id        int64
 	ChatId    int64
+	Name      string
 	CreatedAt int64
-	Period    int
+	Period    int               // seconds between events counted from CreatedAt, unused when Schedule is set
+	Schedule  schedule.Schedule // calendar schedule like "weekdays at 12:30"
+	Paused    bool
+	// PausedUntil is unix time when the paused subscription resumes itself, zero means until resumed by user
+	PausedUntil int64
+	Filter      CategoryFilter
 }
 
 func (s Subscription) SubscribedAtAsUnixTime() time.Time {
@@ -15,3 +30,20 @@ func (s Subscription) SubscribedAtAsUnixTime() time.Time {
 func (s Subscription) PeriodAsDurationInSeconds() time.Duration {
 	return time.Duration(s.Period) * time.Second
 }
+
+// NextRun returns the first scheduled event strictly after the given time.
+func (s Subscription) NextRun(after time.Time) time.Time {
+	if !s.Schedule.IsZero() {
+		return s.Schedule.Next(after)
+	}
+
+	passedIntervals := after.Sub(s.SubscribedAtAsUnixTime()) / s.PeriodAsDurationInSeconds()
+
+	return s.SubscribedAtAsUnixTime().Add((passedIntervals + 1) * s.PeriodAsDurationInSeconds())
+}
+
+// IsValidSubscriptionName reports whether the name can be used for a subscription,
+// names are kept short to fit into inline keyboard callback data.
+func IsValidSubscriptionName(name string) bool {
+	return subscriptionNameRe.MatchString(name)
+}
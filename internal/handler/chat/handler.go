@@ -0,0 +1,211 @@
+package chat
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	imageH "apubot/internal/handler/image"
+	"apubot/internal/service/chat"
+	"apubot/internal/service/subscription"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/utils/clock"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+const quietHoursHelp = "Send /quiet 23:00-08:00 to hold scheduled pictures until the morning, " +
+	"/quiet 23:00-08:00 skip to drop them or /quiet off to disable quiet hours."
+
+type botApi interface {
+	SendMessage(ctx context.Context, chatID int64, message string)
+	SendKeyboard(ctx context.Context, chatID int64, message string, keyboard tgbotapi.InlineKeyboardMarkup)
+}
+
+type (
+	Handler struct {
+		cfg      *config.Config
+		api      botApi
+		clock    clock.Clock
+		services *Services
+	}
+	Services struct {
+		Chat         chat.ChatService
+		Subscription subscription.SubscriptionService
+	}
+)
+
+func New(cfg *config.Config, botAPI botApi, clk clock.Clock, services *Services) *Handler {
+	return &Handler{
+		cfg:      cfg,
+		api:      botAPI,
+		clock:    clk,
+		services: services,
+	}
+}
+
+// MemberUpdated tracks bot membership in the chat, pausing subscription when access is lost.
+func (h *Handler) MemberUpdated(ctx context.Context, upd *tgbotapi.ChatMemberUpdated) {
+	chatId := upd.Chat.ID
+	status := memberStatus(upd.NewChatMember)
+
+	prev, err := h.services.Chat.UpdateStatus(ctx, chatId, status)
+	if err != nil {
+		log.Printf("Error updating chat %d status: %v", chatId, err)
+
+		return
+	}
+
+	if prev.Status == status {
+		return
+	}
+
+	log.Printf("Bot status in chat %d changed: %q -> %q", chatId, prev.Status, status)
+
+	switch status {
+	case domain.ChatStatusKicked, domain.ChatStatusLeft:
+		// nothing is scheduled for subscriptions paused without time limit, so no send function is needed
+		err = h.services.Subscription.Pause(ctx, chatId, time.Time{}, nil)
+		if err != nil {
+			var notFoundErr *custom_errors.NotFoundError
+			if !errors.As(err, &notFoundErr) {
+				log.Printf("Error pausing subscription %d: %v", chatId, err)
+			}
+
+			return
+		}
+
+		log.Printf("Bot lost access to chat %d, subscriptions paused", chatId)
+	case domain.ChatStatusMember:
+		subs, err := h.services.Subscription.List(ctx, chatId)
+		if err != nil {
+			log.Printf("Error getting subscriptions %d: %v", chatId, err)
+
+			return
+		}
+
+		paused := slices.ContainsFunc(subs, func(sub domain.Subscription) bool { return sub.Paused })
+		if !paused {
+			return
+		}
+
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Resume", imageH.ResumeCallback),
+		))
+
+		msgText := "Welcome back! Your subscriptions are paused, resume them to continue receiving pictures."
+		h.api.SendKeyboard(ctx, chatId, msgText, keyboard)
+	}
+}
+
+func memberStatus(member tgbotapi.ChatMember) string {
+	switch {
+	case member.WasKicked():
+		return domain.ChatStatusKicked
+	case member.HasLeft():
+		return domain.ChatStatusLeft
+	case member.Status == "restricted" && !member.IsMember:
+		return domain.ChatStatusLeft
+	default:
+		return domain.ChatStatusMember
+	}
+}
+
+// SetTimezone handles "/timezone [zone]", without arguments current setting is shown.
+func (h *Handler) SetTimezone(ctx context.Context, message *tgbotapi.Message) {
+	chatId := message.Chat.ID
+	timezone := strings.TrimSpace(message.CommandArguments())
+
+	if timezone == "" {
+		chat, err := h.services.Chat.Get(ctx, chatId)
+		if err != nil {
+			log.Printf("Error getting chat %d: %v", chatId, err)
+			h.api.SendMessage(ctx, chatId, "Can not get chat settings :d")
+
+			return
+		}
+
+		msgText := fmt.Sprintf(
+			"Current time zone: %s, local time: %s\n"+
+				"Send /timezone <zone> to change it, like: /timezone Europe/Berlin",
+			chat.Location(), h.clock.Now().In(chat.Location()).Format("15:04"),
+		)
+		h.api.SendMessage(ctx, chatId, msgText)
+
+		return
+	}
+
+	err := h.services.Chat.SetTimezone(ctx, chatId, timezone)
+	if err != nil {
+		msgText := "Can not update time zone :d"
+
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			msgText = fmt.Sprintf("Unknown time zone: %s! Use names like Europe/Berlin or America/New_York.", timezone)
+		} else {
+			log.Printf("Error setting chat %d time zone: %v", chatId, err)
+		}
+
+		h.api.SendMessage(ctx, chatId, msgText)
+
+		return
+	}
+
+	// schedules like "every day at 09:00" now fire at another moment
+	h.services.Subscription.Reschedule(ctx, chatId)
+
+	h.api.SendMessage(ctx, chatId, fmt.Sprintf("Time zone set to: %s", timezone))
+}
+
+// SetQuietHours handles "/quiet [from-to [defer|skip]|off]", without arguments current setting is shown.
+func (h *Handler) SetQuietHours(ctx context.Context, message *tgbotapi.Message) {
+	chatId := message.Chat.ID
+	args := strings.Fields(strings.ToLower(message.CommandArguments()))
+
+	if len(args) == 0 {
+		chat, err := h.services.Chat.Get(ctx, chatId)
+		if err != nil {
+			log.Printf("Error getting chat %d: %v", chatId, err)
+			h.api.SendMessage(ctx, chatId, "Can not get chat settings :d")
+
+			return
+		}
+
+		msgText := fmt.Sprintf("Current quiet hours: %s\n", chat.QuietHours) + quietHoursHelp
+		h.api.SendMessage(ctx, chatId, msgText)
+
+		return
+	}
+
+	var quiet domain.QuietHours
+
+	if args[0] != "off" {
+		policy := domain.QuietPolicyDefer
+		if len(args) > 1 {
+			policy = args[1]
+		}
+
+		var err error
+
+		quiet, err = domain.ParseQuietHours(args[0], policy)
+		if err != nil {
+			h.api.SendMessage(ctx, chatId, fmt.Sprintf("Invalid quiet hours: %v!\n", err)+quietHoursHelp)
+
+			return
+		}
+	}
+
+	err := h.services.Chat.SetQuietHours(ctx, chatId, quiet)
+	if err != nil {
+		log.Printf("Error setting chat %d quiet hours: %v", chatId, err)
+		h.api.SendMessage(ctx, chatId, "Can not update quiet hours :d")
+
+		return
+	}
+
+	h.api.SendMessage(ctx, chatId, fmt.Sprintf("Quiet hours set to: %s", quiet))
+}
@@ -0,0 +1,109 @@
+package dialog
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/service/dialog"
+	"apubot/pkg/custom_errors"
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"log"
+)
+
+// StateEnd returned by a state handler finishes the dialog.
+const StateEnd = ""
+
+type botApi interface {
+	SendMessage(ctx context.Context, chatID int64, message string)
+}
+
+type (
+	// StateFunc handles a message received while the dialog is in its state and returns the next state.
+	// Returning the same state waits for another message, e.g. after invalid input.
+	StateFunc func(ctx context.Context, session *domain.DialogSession, message *tgbotapi.Message) (next string)
+
+	Handler struct {
+		cfg      *config.Config
+		api      botApi
+		services *Services
+		states   map[string]StateFunc
+	}
+	Services struct {
+		Dialog dialog.DialogService
+	}
+)
+
+func New(cfg *config.Config, botAPI botApi, services *Services) *Handler {
+	return &Handler{
+		cfg:      cfg,
+		api:      botAPI,
+		services: services,
+		states:   make(map[string]StateFunc),
+	}
+}
+
+// Register sets the handler of messages received in the state, must be called before updates are handled.
+func (h *Handler) Register(state string, fn StateFunc) {
+	h.states[state] = fn
+}
+
+// HandleMessage passes the message to the handler of the chat dialog state,
+// returns false if the chat has no active dialog.
+func (h *Handler) HandleMessage(ctx context.Context, message *tgbotapi.Message) bool {
+	chatId := message.Chat.ID
+
+	session, err := h.services.Dialog.Get(ctx, chatId)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if !errors.As(err, &notFoundErr) {
+			log.Printf("Error getting dialog %d: %v", chatId, err)
+		}
+
+		return false
+	}
+
+	fn, ok := h.states[session.State]
+	if !ok {
+		log.Printf("Unknown dialog state %q in chat %d, dropping dialog", session.State, chatId)
+		h.finish(ctx, chatId)
+
+		return false
+	}
+
+	session.State = fn(ctx, &session, message)
+	if session.State == StateEnd {
+		h.finish(ctx, chatId)
+
+		return true
+	}
+
+	err = h.services.Dialog.Continue(ctx, session)
+	if err != nil {
+		log.Printf("Error saving dialog %d: %v", chatId, err)
+	}
+
+	return true
+}
+
+// Cancel handles /cancel command dropping the active dialog.
+func (h *Handler) Cancel(ctx context.Context, message *tgbotapi.Message) {
+	chatId := message.Chat.ID
+
+	_, err := h.services.Dialog.Get(ctx, chatId)
+	if err != nil {
+		h.api.SendMessage(ctx, chatId, "Nothing to cancel!")
+
+		return
+	}
+
+	h.finish(ctx, chatId)
+	h.api.SendMessage(ctx, chatId, "Cancelled.")
+}
+
+func (h *Handler) finish(ctx context.Context, chatId int64) {
+	err := h.services.Dialog.Finish(ctx, chatId)
+	if err != nil {
+		log.Printf("Error finishing dialog %d: %v", chatId, err)
+	}
+}
@@ -2,11 +2,13 @@ package general
 
 import (
 	"apubot/internal/config"
+	"context"
+	"strings"
 )
 
 type (
 	botApi interface {
-		SendMessage(chatID int64, message string)
+		SendMessage(ctx context.Context, chatID int64, message string)
 	}
 
 	Handler struct {
@@ -22,23 +24,19 @@ func New(cfg *config.Config, botAPI botApi) *Handler {
 	}
 }
 
-func (h *Handler) MessageResponse(chatID int64, message string) {
-	h.api.SendMessage(chatID, message)
+func (h *Handler) MessageResponse(ctx context.Context, chatID int64, message string) {
+	h.api.SendMessage(ctx, chatID, message)
 }
 
-func (h *Handler) StartResponse(chatID int64) {
+func (h *Handler) StartResponse(ctx context.Context, chatID int64) {
 	message := "Welcome to peepobot. Now you can use any available command."
 
-	h.api.SendMessage(chatID, message)
+	h.api.SendMessage(ctx, chatID, message)
 }
 
-func (h *Handler) HelpResponse(chatID int64) {
-	message := "Command list help:\n" +
-		"/peepo - Get random picture;\n" +
-		"/sub - Subscribe to receive pictures periodically;\n" +
-		"/sub_info - Get info about current subscription;\n" +
-		"/unsub - Drop current subscription;\n" +
-		"/help - Get this list."
+// HelpResponse sends the list of commands, each line is a command usage with its description.
+func (h *Handler) HelpResponse(ctx context.Context, chatID int64, commands []string) {
+	message := "Command list help:\n" + strings.Join(commands, ";\n") + "."
 
-	h.api.SendMessage(chatID, message)
+	h.api.SendMessage(ctx, chatID, message)
 }
@@ -3,10 +3,15 @@ package image
 import (
 	"apubot/internal/config"
 	"apubot/internal/domain"
+	dialogH "apubot/internal/handler/dialog"
+	"apubot/internal/infrastructure/webapi/tg_bot"
+	"apubot/internal/service/chat"
+	"apubot/internal/service/dialog"
 	"apubot/internal/service/image"
 	"apubot/internal/service/subscription"
 	"apubot/pkg/custom_errors"
-	"apubot/pkg/utils/queue"
+	"apubot/pkg/utils/clock"
+	"apubot/pkg/utils/schedule"
 	"apubot/pkg/utils/time_string"
 	"context"
 	"fmt"
@@ -15,34 +20,79 @@ import (
 	"log"
 	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Prefixes of inline keyboard callback data, they route pressed buttons to the handler which sent them.
+const (
+	SubscribeCallback   = "sub"
+	UnsubscribeCallback = "unsub"
+	ResumeCallback      = "resume"
+)
+
+const (
+	customCallbackArg = "custom"
+	cancelCallbackArg = "cancel"
+	presetsPerRow     = 3
+
+	dialogNameKey = "name"
+
+	// subscriptionNamePrefix marks the name explicitly, it is needed for names matching a category
+	subscriptionNamePrefix = "name="
+
+	// scheduleCheckEvents is the number of upcoming events checked against the minimum interval
+	scheduleCheckEvents = 50
+
+	pausedUntilLayout = "Jan 2 15:04 MST"
+
+	// maxSkippedEvents limits the search of the event outside quiet hours
+	maxSkippedEvents = 1000
+)
+
 type botApi interface {
-	SendMessage(chatID int64, message string)
-	SendAttachment(att tgbotapi.Chattable) (res tgbotapi.Message, err error)
+	SendMessage(ctx context.Context, chatID int64, message string)
+	SendKeyboard(ctx context.Context, chatID int64, message string, keyboard tgbotapi.InlineKeyboardMarkup)
+	EditMessage(ctx context.Context, chatID int64, messageID int, message string)
+	AnswerCallback(ctx context.Context, callbackID string, text string)
+	SendAttachment(ctx context.Context, att tgbotapi.Chattable) (res tgbotapi.Message, err error)
 }
 
 type (
 	Handler struct {
 		cfg      *config.Config
 		api      botApi
+		clock    clock.Clock
 		services *Services
+
+		// warm up of telegram ids runs in background, one at a time
+		warming    atomic.Bool
+		warmers    sync.WaitGroup
+		warmCtx    context.Context
+		cancelWarm context.CancelFunc
 	}
 	Services struct {
+		Chat         chat.ChatService
+		Dialog       dialog.DialogService
 		Image        image.ImageService
 		Subscription subscription.SubscriptionService
 	}
 )
 
-func New(cfg *config.Config, botAPI botApi, services *Services) *Handler {
+func New(cfg *config.Config, botAPI botApi, clk clock.Clock, services *Services) *Handler {
 	h := &Handler{
 		cfg:      cfg,
 		api:      botAPI,
+		clock:    clk,
 		services: services,
 	}
 
+	h.warmCtx, h.cancelWarm = context.WithCancel(context.Background())
+
 	err := h.services.Subscription.RescheduleExisting(context.Background(), h.sendImage)
 	if err != nil {
 		log.Fatal(err)
@@ -52,112 +102,594 @@ func New(cfg *config.Config, botAPI botApi, services *Services) *Handler {
 }
 
 func (h *Handler) GetImage(ctx context.Context, message *tgbotapi.Message) {
-	file, err := h.services.Image.GetRandomFile(ctx)
-	if err != nil {
-		log.Printf("Error getting file: %v", err)
+	filter := domain.ParseCategoryFilter(strings.Fields(message.CommandArguments()))
+
+	if !h.hasAccess(ctx, message.Chat.ID) {
+		log.Printf("Bot has no access to chat %d, image is not sent", message.Chat.ID)
 
 		return
 	}
 
-	attachment, err := h.createAttachment(file, message.Chat.ID)
+	err := h.sendRandomImage(ctx, message.Chat.ID, filter)
 	if err != nil {
-		log.Printf("Error creating attachment: %v", err)
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			msgText := "No pictures in selected categories! Use /categories to list available ones."
+			h.api.SendMessage(ctx, message.Chat.ID, msgText)
+
+			return
+		}
+
+		log.Printf("Error sending image: %v", err)
+	}
+}
+
+func (h *Handler) GetCategories(ctx context.Context, message *tgbotapi.Message) {
+	categories := h.services.Image.GetCategories(ctx)
+	if len(categories) == 0 {
+		h.api.SendMessage(ctx, message.Chat.ID, "No categories available!")
 
 		return
 	}
 
-	res, err := h.api.SendAttachment(attachment)
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	msgText := "Available categories:"
+	for _, name := range names {
+		msgText += fmt.Sprintf("\n%s - %d", name, categories[name])
+	}
+
+	h.api.SendMessage(ctx, message.Chat.ID, msgText)
+}
+
+// CreateSubscription handles "/sub [name] [period|schedule] [categories]".
+// Command without period offers a keyboard of preset periods, invalid input starts a dialog waiting for the valid one.
+func (h *Handler) CreateSubscription(ctx context.Context, message *tgbotapi.Message) {
+	chatId := message.Chat.ID
+	tokens := strings.Fields(strings.ToLower(message.CommandArguments()))
+
+	name, tokens := h.cutSubscriptionName(ctx, tokens)
+	if !domain.IsValidSubscriptionName(name) {
+		msgText := "Subscription name must be up to 32 latin letters, digits, dashes or underscores!"
+		h.api.SendMessage(ctx, chatId, msgText)
+
+		return
+	}
+
+	if len(tokens) == 0 && len(h.cfg.SubscriptionPresets) > 0 {
+		h.sendPresetsKeyboard(ctx, chatId, name)
+
+		return
+	}
+
+	inp, err := h.parseAndValidateSubscriptionInput(ctx, chatId, tokens)
 	if err != nil {
+		msgText := err.Error()
+
+		err = h.startSubscriptionDialog(ctx, chatId, name)
+		if err != nil {
+			msgText = "Error creating subscription!"
+		}
+
+		h.api.SendMessage(ctx, chatId, msgText)
+
 		return
 	}
 
-	if file.TgID == "" {
-		h.updateFile(ctx, file, res)
+	inp.Name = name
+
+	msgText, _ := h.saveSubscription(ctx, inp)
+	h.api.SendMessage(ctx, chatId, msgText)
+}
+
+// cutSubscriptionName takes the subscription name off the command arguments.
+// The first token is the name when written as "name=<name>" or when it can not start a schedule
+// and is not a category, otherwise the default name is used.
+func (h *Handler) cutSubscriptionName(ctx context.Context, tokens []string) (string, []string) {
+	if len(tokens) == 0 {
+		return domain.DefaultSubscriptionName, tokens
+	}
+
+	if name, ok := strings.CutPrefix(tokens[0], subscriptionNamePrefix); ok {
+		return name, tokens[1:]
 	}
+
+	_, isCategory := h.services.Image.GetCategories(ctx)[tokens[0]]
+	isFilter := isCategory || tokens[0] == domain.FilterAll || strings.ContainsAny(tokens[0][:1], "+-")
+
+	if isFilter || schedule.IsStart(tokens[0]) {
+		return domain.DefaultSubscriptionName, tokens
+	}
+
+	return tokens[0], tokens[1:]
 }
 
-func (h *Handler) CreateSubscription(ctx context.Context, message *tgbotapi.Message) error {
-	inp, err := h.parseAndValidateSubscriptionInput(message)
+// SubscriptionInputStep handles the period or schedule sent in DialogStateSubscriptionInput state.
+func (h *Handler) SubscriptionInputStep(
+	ctx context.Context,
+	session *domain.DialogSession,
+	message *tgbotapi.Message,
+) string {
+	tokens := strings.Fields(strings.ToLower(message.Text))
+
+	inp, err := h.parseAndValidateSubscriptionInput(ctx, message.Chat.ID, tokens)
 	if err != nil {
-		h.api.SendMessage(message.Chat.ID, err.Error())
+		h.api.SendMessage(ctx, message.Chat.ID, err.Error())
 
-		return err
+		return session.State // wait for valid input
+	}
+
+	inp.Name = session.Data[dialogNameKey]
+	if inp.Name == "" {
+		inp.Name = domain.DefaultSubscriptionName
 	}
 
-	err = h.services.Subscription.Create(ctx, inp, h.sendImage)
+	msgText, _ := h.saveSubscription(ctx, inp)
+	h.api.SendMessage(ctx, message.Chat.ID, msgText)
+
+	return dialogH.StateEnd
+}
+
+// startSubscriptionDialog makes the next message of the chat be read as a period of the named subscription.
+func (h *Handler) startSubscriptionDialog(ctx context.Context, chatId int64, name string) error {
+	data := map[string]string{dialogNameKey: name}
+
+	err := h.services.Dialog.Start(ctx, chatId, domain.DialogStateSubscriptionInput, data)
 	if err != nil {
-		log.Printf("Error creating subscription: %v", err)
-		h.api.SendMessage(message.Chat.ID, "Error creating subscription!")
+		log.Printf("Error starting subscription dialog: %v", err)
 
 		return err
 	}
 
-	h.api.SendMessage(message.Chat.ID, "Subscription created successfully!")
-
 	return nil
 }
 
-func (h *Handler) GetSubscription(ctx context.Context, message *tgbotapi.Message) {
-	sub, err := h.services.Subscription.Get(ctx, message.Chat.ID)
+// sendPresetsKeyboard offers preset periods for the subscription,
+// button data looks like "sub:<name>:<seconds>", "sub:<name>:custom" or "sub:<name>:cancel".
+func (h *Handler) sendPresetsKeyboard(ctx context.Context, chatId int64, name string) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+
+	for _, preset := range h.cfg.SubscriptionPresets {
+		text := "every " + time_string.ShortDur(preset)
+		data := fmt.Sprintf("%s:%s:%d", SubscribeCallback, name, int(preset.Seconds()))
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(text, data))
+
+		if len(row) == presetsPerRow {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Custom", SubscribeCallback+":"+name+":"+customCallbackArg),
+		tgbotapi.NewInlineKeyboardButtonData("Cancel", SubscribeCallback+":"+name+":"+cancelCallbackArg),
+	))
+
+	msgText := fmt.Sprintf("How often should subscription %q send pictures?", name)
+	h.api.SendKeyboard(ctx, chatId, msgText, tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// CreateSubscriptionCallback handles a button of the keyboard sent by sendPresetsKeyboard.
+func (h *Handler) CreateSubscriptionCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	if query.Message == nil {
+		h.api.AnswerCallback(ctx, query.ID, "This message is too old!")
+
+		return
+	}
+
+	chatId := query.Message.Chat.ID
+	messageId := query.Message.MessageID
+
+	parts := strings.Split(query.Data, ":")
+	if len(parts) != 3 || !domain.IsValidSubscriptionName(parts[1]) {
+		log.Printf("Invalid subscribe callback data %q", query.Data)
+		h.api.AnswerCallback(ctx, query.ID, "Unknown button!")
+
+		return
+	}
+
+	name, arg := parts[1], parts[2]
+
+	switch arg {
+	case cancelCallbackArg:
+		h.api.AnswerCallback(ctx, query.ID, "")
+		h.api.EditMessage(ctx, chatId, messageId, "Subscription is not created.")
+
+		return
+	case customCallbackArg:
+		msgText := h.subscriptionInputHelp()
+
+		err := h.startSubscriptionDialog(ctx, chatId, name)
+		if err != nil {
+			msgText = "Error creating subscription!"
+		}
+
+		h.api.AnswerCallback(ctx, query.ID, "")
+		h.api.EditMessage(ctx, chatId, messageId, msgText)
+
+		return
+	}
+
+	seconds, err := strconv.Atoi(arg)
+	if err != nil || !slices.Contains(h.cfg.SubscriptionPresets, time.Duration(seconds)*time.Second) {
+		log.Printf("Invalid subscribe callback data %q", query.Data)
+		h.api.AnswerCallback(ctx, query.ID, "Unknown button!")
+
+		return
+	}
+
+	inp := domain.Subscription{
+		ChatId:    chatId,
+		Name:      name,
+		CreatedAt: h.clock.Now().Unix(),
+		Period:    seconds,
+	}
+
+	// the preset only changes how often pictures are sent, filter and pause of the replaced subscription are kept
+	existing, err := h.services.Subscription.Get(ctx, chatId, name)
+
+	var notFoundErr *custom_errors.NotFoundError
+	if err != nil && !errors.As(err, &notFoundErr) {
+		log.Printf("Error getting subscription %q of chat %d: %v", name, chatId, err)
+		h.api.AnswerCallback(ctx, query.ID, "Error creating subscription!")
+
+		return
+	}
+
+	if err == nil {
+		inp.Filter = existing.Filter
+		inp.Paused = existing.Paused
+		inp.PausedUntil = existing.PausedUntil
+	}
+
+	msgText, _ := h.saveSubscription(ctx, inp)
+
+	h.api.AnswerCallback(ctx, query.ID, "")
+	h.api.EditMessage(ctx, chatId, messageId, msgText)
+}
+
+// saveSubscription creates the subscription and returns the text reporting the result to user.
+func (h *Handler) saveSubscription(ctx context.Context, inp domain.Subscription) (string, error) {
+	err := h.services.Subscription.Create(ctx, inp, h.sendImage)
 	if err != nil {
-		msgText := "Error getting subscription :d"
+		msgText := "Error creating subscription!"
 
-		var notFoundErr *custom_errors.NotFoundError
-		if errors.As(err, &notFoundErr) {
-			msgText = "No active subscription found!"
+		var limitErr *custom_errors.LimitExceededError
+		if errors.As(err, &limitErr) {
+			msgText = fmt.Sprintf(
+				"Chat can have at most %d subscriptions, use /unsub to drop one!",
+				h.cfg.MaxSubscriptionsPerChat,
+			)
+		} else {
+			log.Printf("Error creating subscription: %v", err)
 		}
 
-		h.api.SendMessage(message.Chat.ID, msgText)
+		return msgText, err
+	}
+
+	msgText := fmt.Sprintf("Subscription %q created successfully: %s!", inp.Name, scheduleString(inp))
+	if inp.Paused {
+		msgText += " It stays paused, send /resume to continue receiving pictures."
+	}
+
+	return msgText, nil
+}
+
+func (h *Handler) GetSubscription(ctx context.Context, message *tgbotapi.Message) {
+	subs, err := h.services.Subscription.List(ctx, message.Chat.ID)
+	if err != nil {
+		h.api.SendMessage(ctx, message.Chat.ID, "Error getting subscription :d")
 
 		return
 	}
 
-	createdAt := sub.SubscribedAtAsUnixTime().String()
-	period := time_string.ShortDur(sub.PeriodAsDurationInSeconds())
-	passedIntervals := time.Since(sub.SubscribedAtAsUnixTime()) / sub.PeriodAsDurationInSeconds()
-	nextEvent := sub.SubscribedAtAsUnixTime().Add((passedIntervals + 1) * sub.PeriodAsDurationInSeconds())
+	if len(subs) == 0 {
+		h.api.SendMessage(ctx, message.Chat.ID, "No active subscription found!")
 
-	msgText := "Current subscription info:\n" +
-		fmt.Sprintf("Created at: %s\n", createdAt) +
-		fmt.Sprintf("Period: %s\n", period) +
-		fmt.Sprintf("Next peepo: %s", nextEvent)
+		return
+	}
 
-	h.api.SendMessage(message.Chat.ID, msgText)
+	chat, err := h.services.Chat.Get(ctx, message.Chat.ID)
+	if err != nil {
+		h.api.SendMessage(ctx, message.Chat.ID, "Error getting subscription :d")
+
+		return
+	}
+
+	loc := chat.Location()
+	now := h.clock.Now().In(loc)
+	msgText := "Current subscriptions info:\n" +
+		fmt.Sprintf("Time zone: %s\n", loc) +
+		fmt.Sprintf("Quiet hours: %s", chat.QuietHours)
+
+	for _, sub := range subs {
+		createdAt := sub.SubscribedAtAsUnixTime().In(loc).String()
+
+		msgText += fmt.Sprintf("\n\n%q\n", sub.Name) +
+			fmt.Sprintf("Created at: %s\n", createdAt) +
+			fmt.Sprintf("Schedule: %s\n", scheduleString(sub)) +
+			fmt.Sprintf("Categories: %s\n", sub.Filter)
+
+		switch {
+		case sub.Paused && sub.PausedUntil > 0:
+			msgText += fmt.Sprintf(
+				"Paused until %s, send /resume to continue earlier",
+				time.Unix(sub.PausedUntil, 0).In(loc).Format(pausedUntilLayout),
+			)
+		case sub.Paused:
+			msgText += "Paused, send /resume to continue"
+		default:
+			msgText += fmt.Sprintf("Next peepo: %s", nextSend(sub, chat.QuietHours, now))
+		}
+	}
+
+	h.api.SendMessage(ctx, message.Chat.ID, msgText)
 }
 
+// DeleteSubscription drops the subscription named in command arguments,
+// otherwise lets user pick one with an inline keyboard.
 func (h *Handler) DeleteSubscription(ctx context.Context, message *tgbotapi.Message) {
-	sub, err := h.services.Subscription.Get(ctx, message.Chat.ID)
+	subs, err := h.services.Subscription.List(ctx, message.Chat.ID)
+	if err != nil {
+		h.api.SendMessage(ctx, message.Chat.ID, "Error getting subscription :d")
+
+		return
+	}
+
+	if len(subs) == 0 {
+		h.api.SendMessage(ctx, message.Chat.ID, "No active subscription found!")
+
+		return
+	}
+
+	if name := strings.ToLower(strings.TrimSpace(message.CommandArguments())); name != "" {
+		idx := slices.IndexFunc(subs, func(sub domain.Subscription) bool { return sub.Name == name })
+		if idx < 0 {
+			h.api.SendMessage(ctx, message.Chat.ID, fmt.Sprintf("No subscription named %q found!", name))
+
+			return
+		}
+
+		err = h.services.Subscription.Delete(ctx, message.Chat.ID, subs[idx].Id)
+		if err != nil {
+			h.api.SendMessage(ctx, message.Chat.ID, "Can not delete subscription :d")
+
+			return
+		}
+
+		h.api.SendMessage(ctx, message.Chat.ID, fmt.Sprintf("Subscription %q deleted successfully!", name))
+
+		return
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(subs)+1)
+	for _, sub := range subs {
+		text := fmt.Sprintf("%s (%s)", sub.Name, scheduleString(sub))
+		data := fmt.Sprintf("%s:%d", UnsubscribeCallback, sub.Id)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(text, data)))
+	}
+
+	cancelData := UnsubscribeCallback + ":" + cancelCallbackArg
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Cancel", cancelData)))
+
+	h.api.SendKeyboard(ctx, message.Chat.ID, "Which subscription to delete?", tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// DeleteSubscriptionCallback handles a button of the keyboard sent by DeleteSubscription.
+func (h *Handler) DeleteSubscriptionCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	if query.Message == nil {
+		h.api.AnswerCallback(ctx, query.ID, "This message is too old!")
+
+		return
+	}
+
+	chatId := query.Message.Chat.ID
+	messageId := query.Message.MessageID
+	_, arg, _ := strings.Cut(query.Data, ":")
+
+	if arg == cancelCallbackArg {
+		h.api.AnswerCallback(ctx, query.ID, "")
+		h.api.EditMessage(ctx, chatId, messageId, "Nothing deleted.")
+
+		return
+	}
+
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		log.Printf("Invalid unsubscribe callback data %q: %v", query.Data, err)
+		h.api.AnswerCallback(ctx, query.ID, "Unknown button!")
+
+		return
+	}
+
+	subs, err := h.services.Subscription.List(ctx, chatId)
+	if err != nil {
+		h.api.AnswerCallback(ctx, query.ID, "Error getting subscription :d")
+
+		return
+	}
+
+	idx := slices.IndexFunc(subs, func(sub domain.Subscription) bool { return sub.Id == id })
+	if idx < 0 {
+		h.api.AnswerCallback(ctx, query.ID, "")
+		h.api.EditMessage(ctx, chatId, messageId, "Subscription is already deleted!")
+
+		return
+	}
+
+	err = h.services.Subscription.Delete(ctx, chatId, id)
+	if err != nil {
+		h.api.AnswerCallback(ctx, query.ID, "Can not delete subscription :d")
+
+		return
+	}
+
+	h.api.AnswerCallback(ctx, query.ID, "")
+	h.api.EditMessage(ctx, chatId, messageId, fmt.Sprintf("Subscription %q deleted successfully!", subs[idx].Name))
+}
+
+// SetSubscriptionFilter handles "/sub_filter [name] <categories>", name can be omitted when chat has one subscription.
+func (h *Handler) SetSubscriptionFilter(ctx context.Context, message *tgbotapi.Message) {
+	args := strings.Fields(strings.ToLower(message.CommandArguments()))
+	if len(args) == 0 {
+		msgText := "Please specify categories like: /sub_filter [name] happy -sad\n" +
+			"Prefix category with minus to exclude it, use \"all\" to receive every picture."
+		h.api.SendMessage(ctx, message.Chat.ID, msgText)
+
+		return
+	}
+
+	subs, err := h.services.Subscription.List(ctx, message.Chat.ID)
+	if err != nil {
+		h.api.SendMessage(ctx, message.Chat.ID, "Can not update subscription :d")
+
+		return
+	}
+
+	if len(subs) == 0 {
+		h.api.SendMessage(ctx, message.Chat.ID, "No active subscription found!")
+
+		return
+	}
+
+	idx := -1
+	if len(args) > 1 {
+		idx = slices.IndexFunc(subs, func(sub domain.Subscription) bool { return sub.Name == args[0] })
+	}
+
+	switch {
+	case idx >= 0:
+		args = args[1:]
+	case len(subs) == 1:
+		idx = 0
+	default:
+		msgText := "Chat has several subscriptions, please specify one like: /sub_filter main happy"
+		h.api.SendMessage(ctx, message.Chat.ID, msgText)
+
+		return
+	}
+
+	filter := domain.ParseCategoryFilter(args)
+
+	err = h.validateFilter(ctx, filter)
 	if err != nil {
-		msgText := "Error getting subscription :d"
+		h.api.SendMessage(ctx, message.Chat.ID, err.Error())
+
+		return
+	}
+
+	err = h.services.Subscription.SetFilter(ctx, subs[idx], filter, h.sendImage)
+	if err != nil {
+		h.api.SendMessage(ctx, message.Chat.ID, "Can not update subscription :d")
+
+		return
+	}
+
+	h.api.SendMessage(ctx, message.Chat.ID, fmt.Sprintf("Subscription %q categories set to: %s", subs[idx].Name, filter))
+}
+
+// PauseSubscription handles "/pause [duration]", subscriptions are paused until /resume when duration is omitted.
+func (h *Handler) PauseSubscription(ctx context.Context, message *tgbotapi.Message) {
+	var until time.Time
+
+	if arg := strings.ReplaceAll(message.CommandArguments(), " ", ""); arg != "" {
+		duration, err := time_string.ParseDur(strings.ToLower(arg))
+		if err != nil || duration <= 0 {
+			h.api.SendMessage(ctx, message.Chat.ID, "Please enter pause duration in format like 2d, 12h or 1h30m!")
+
+			return
+		}
+
+		until = h.clock.Now().Add(duration)
+	}
+
+	err := h.services.Subscription.Pause(ctx, message.Chat.ID, until, h.sendImage)
+	if err != nil {
+		msgText := "Can not pause subscription :d"
 
 		var notFoundErr *custom_errors.NotFoundError
 		if errors.As(err, &notFoundErr) {
 			msgText = "No active subscription found!"
 		}
 
-		h.api.SendMessage(message.Chat.ID, msgText)
+		h.api.SendMessage(ctx, message.Chat.ID, msgText)
+
+		return
+	}
+
+	if until.IsZero() {
+		h.api.SendMessage(ctx, message.Chat.ID, "Subscriptions paused, send /resume to continue receiving pictures.")
 
 		return
 	}
 
-	err = h.services.Subscription.Delete(ctx, sub.ChatId)
+	chat, err := h.services.Chat.Get(ctx, message.Chat.ID)
 	if err != nil {
-		h.api.SendMessage(message.Chat.ID, "Can not delete subscription :d")
+		log.Printf("Error getting chat %d: %v", message.Chat.ID, err)
+	}
+
+	msgText := fmt.Sprintf(
+		"Subscriptions paused until %s, send /resume to continue earlier.",
+		until.In(chat.Location()).Format(pausedUntilLayout),
+	)
+	h.api.SendMessage(ctx, message.Chat.ID, msgText)
+}
+
+func (h *Handler) ResumeSubscription(ctx context.Context, message *tgbotapi.Message) {
+	h.api.SendMessage(ctx, message.Chat.ID, h.resumeSubscriptions(ctx, message.Chat.ID))
+}
+
+// ResumeSubscriptionCallback handles the button offering to resume subscriptions paused while the bot had no access.
+func (h *Handler) ResumeSubscriptionCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	if query.Message == nil {
+		h.api.AnswerCallback(ctx, query.ID, "This message is too old!")
 
 		return
 	}
 
-	h.api.SendMessage(message.Chat.ID, "Subscription deleted successfully!")
+	chatId := query.Message.Chat.ID
+
+	h.api.AnswerCallback(ctx, query.ID, "")
+	h.api.EditMessage(ctx, chatId, query.Message.MessageID, h.resumeSubscriptions(ctx, chatId))
+}
+
+// resumeSubscriptions resumes paused subscriptions of the chat and returns the reply for the user.
+func (h *Handler) resumeSubscriptions(ctx context.Context, chatId int64) string {
+	err := h.services.Subscription.Resume(ctx, chatId, h.sendImage)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return "No paused subscription found!"
+		}
+
+		return "Can not resume subscription :d"
+	}
+
+	return "Subscriptions resumed successfully!"
 }
 
 func (h *Handler) createAttachment(file domain.File, chatId int64) (a tgbotapi.Chattable, err error) {
 	var reqFile tgbotapi.RequestFileData
 
-	if file.TgID == "" {
+	switch {
+	case file.TgID != "":
+		reqFile = tgbotapi.FileID(file.TgID)
+	case h.cfg.LocalBotAPI.Enabled:
+		// local server reads the file itself, so its size is not limited by HTTP upload
+		reqFile = tgbotapi.FileURL("file://" + path.Join(h.cfg.LocalBotAPI.ImagesDirPath, file.Name))
+	default:
 		fullFilePath := path.Join(h.cfg.ImagesDirPath, file.Name)
 		reqFile = tgbotapi.FilePath(fullFilePath)
-	} else {
-		reqFile = tgbotapi.FileID(file.TgID)
 	}
 
 	switch filepath.Ext(file.Name) {
@@ -165,6 +697,8 @@ func (h *Handler) createAttachment(file domain.File, chatId int64) (a tgbotapi.C
 		a = tgbotapi.NewPhoto(chatId, reqFile)
 	case ".gif":
 		a = tgbotapi.NewDocument(chatId, reqFile)
+	case ".mp4", ".webm":
+		a = tgbotapi.NewVideo(chatId, reqFile)
 	default:
 		err = fmt.Errorf("unsupported image format: %v", filepath.Ext(file.Name))
 	}
@@ -193,6 +727,14 @@ func (h *Handler) updateFile(ctx context.Context, file domain.File, res tgbotapi
 		}
 
 		newTgId = res.Animation.FileID
+	case ".mp4", ".webm":
+		if res.Video == nil {
+			log.Println("Video is nil in response!")
+
+			return
+		}
+
+		newTgId = res.Video.FileID
 	default:
 		log.Printf("Unsupported image format: %v", filepath.Ext(file.Name))
 	}
@@ -212,22 +754,38 @@ func (h *Handler) updateFile(ctx context.Context, file domain.File, res tgbotapi
 }
 
 // sendImage is used as an injected function to subscription service
-func (h *Handler) sendImage(chatId int64, q *queue.Queue) error {
-	ctx := context.Background()
+func (h *Handler) sendImage(ctx context.Context, sub domain.Subscription) error {
+	if !h.hasAccess(ctx, sub.ChatId) {
+		// subscriptions are paused once the bot is kicked, the send is just skipped until then
+		return custom_errors.NewNotFound("bot has no access to the chat")
+	}
 
-	var file domain.File
-	var err error
+	return h.sendRandomImage(ctx, sub.ChatId, sub.Filter)
+}
 
-	for {
-		file, err = h.services.Image.GetRandomFile(ctx)
-		if err != nil {
-			return err
-		}
+// hasAccess reports whether the bot is known to be a member of the chat,
+// access is assumed when the chat can not be loaded and telegram decides.
+func (h *Handler) hasAccess(ctx context.Context, chatId int64) bool {
+	chat, err := h.services.Chat.Get(ctx, chatId)
+	if err != nil {
+		log.Printf("Error getting chat %d: %v", chatId, err)
 
-		// check if file is already in sent queue
-		if !q.Contains(file.Name) {
-			break
-		}
+		return true
+	}
+
+	return chat.HasAccess()
+}
+
+// sendRandomImage sends an image matching the filter which was not among recently sent ones to the chat.
+func (h *Handler) sendRandomImage(ctx context.Context, chatId int64, filter domain.CategoryFilter) error {
+	recentlySent, err := h.services.Image.GetRecentlySent(ctx, chatId)
+	if err != nil {
+		return err
+	}
+
+	file, err := h.services.Image.SelectFile(ctx, filter, recentlySent)
+	if err != nil {
+		return err
 	}
 
 	attachment, err := h.createAttachment(file, chatId)
@@ -235,7 +793,21 @@ func (h *Handler) sendImage(chatId int64, q *queue.Queue) error {
 		return err
 	}
 
-	res, err := h.api.SendAttachment(attachment)
+	res, err := h.api.SendAttachment(ctx, attachment)
+	if err != nil && file.TgID != "" && tg_bot.IsInvalidFileID(err) {
+		// ids are issued per bot, but may be refused after moving to another Bot API server
+		log.Printf("Telegram id of %s is not accepted, sending the file again", file.Name)
+
+		file.TgID = ""
+
+		attachment, err = h.createAttachment(file, chatId)
+		if err != nil {
+			return err
+		}
+
+		res, err = h.api.SendAttachment(ctx, attachment)
+	}
+
 	if err != nil {
 		return err
 	}
@@ -244,28 +816,89 @@ func (h *Handler) sendImage(chatId int64, q *queue.Queue) error {
 		h.updateFile(ctx, file, res)
 	}
 
-	q.Add(file.Name)
+	err = h.services.Image.MarkSent(ctx, chatId, file.Name)
+	if err != nil {
+		log.Printf("Error saving sent history: %v", err)
+	}
 
 	return nil
 }
 
-func (h *Handler) parseAndValidateSubscriptionInput(message *tgbotapi.Message) (domain.Subscription, error) {
-	rawMsg := strings.ReplaceAll(message.Text, " ", "")
-	rawMsg = strings.ToLower(rawMsg)
+// parseAndValidateSubscriptionInput reads a period or a schedule optionally followed by categories,
+// like "1h 30m happy -sad" or "weekdays at 12:30 and 18:00 happy".
+func (h *Handler) parseAndValidateSubscriptionInput(
+	ctx context.Context,
+	chatId int64,
+	tokens []string,
+) (domain.Subscription, error) {
+	inp := domain.Subscription{
+		ChatId:    chatId,
+		CreatedAt: h.clock.Now().Unix(),
+	}
 
-	period, err := time.ParseDuration(rawMsg)
-	if err != nil {
-		errText := "Please enter a period in format like 1h30m\n" +
-			fmt.Sprintf(
-				"Hint: minimum: %s, maximun: %s",
-				time_string.ShortDur(h.cfg.MinSubscriptionInterval),
-				time_string.ShortDur(h.cfg.MaxSubscriptionInterval),
-			)
-		err = errors.New(errText)
+	var filterTokens []string
+
+	sched, n, err := schedule.ParsePrefix(tokens)
+	if err == nil {
+		err = h.validateSchedule(sched)
+		if err != nil {
+			return domain.Subscription{}, err
+		}
+
+		inp.Schedule = sched
+		filterTokens = tokens[n:]
+	} else {
+		var rawPeriod string
+
+		for _, token := range tokens {
+			if isPeriodToken(token) {
+				rawPeriod += token
+			} else {
+				filterTokens = append(filterTokens, token)
+			}
+		}
 
+		period, err := h.parsePeriod(rawPeriod)
+		if err != nil {
+			return domain.Subscription{}, err
+		}
+
+		inp.Period = int(period.Seconds())
+	}
+
+	filter := domain.ParseCategoryFilter(filterTokens)
+
+	err = h.validateFilter(ctx, filter)
+	if err != nil {
 		return domain.Subscription{}, err
 	}
 
+	inp.Filter = filter
+
+	return inp, nil
+}
+
+func (h *Handler) subscriptionInputHelp() string {
+	return "Please enter a period in format like 1h30m or a schedule like \"weekdays at 12:30 and 18:00\", " +
+		"\"every day at 09:00\" or a cron expression \"0 9 * * 1-5\".\n" +
+		"It can be followed by categories like: happy -sad\n" +
+		"Use /sub <name> to create one more subscription, or /sub name=<name> when the name is also a category, " +
+		"/cancel to stop.\n" +
+		fmt.Sprintf(
+			"Hint: period minimum: %s, maximun: %s",
+			time_string.ShortDur(h.cfg.MinSubscriptionInterval),
+			time_string.ShortDur(h.cfg.MaxSubscriptionInterval),
+		)
+}
+
+func (h *Handler) parsePeriod(rawPeriod string) (time.Duration, error) {
+	period, err := time.ParseDuration(rawPeriod)
+	if err != nil {
+		err = errors.New(h.subscriptionInputHelp())
+
+		return 0, err
+	}
+
 	if period.Seconds() < h.cfg.MinSubscriptionInterval.Seconds() ||
 		period.Seconds() > h.cfg.MaxSubscriptionInterval.Seconds() {
 		errText := fmt.Sprintf(
@@ -275,14 +908,63 @@ func (h *Handler) parseAndValidateSubscriptionInput(message *tgbotapi.Message) (
 		)
 		err = errors.New(errText)
 
-		return domain.Subscription{}, err
+		return 0, err
 	}
 
-	inp := domain.Subscription{
-		ChatId:    message.Chat.ID,
-		CreatedAt: time.Now().Unix(),
-		Period:    int(period.Seconds()),
+	return period, nil
+}
+
+// validateSchedule checks that upcoming events of the schedule are not closer than the minimum interval.
+func (h *Handler) validateSchedule(sched schedule.Schedule) error {
+	if gap := sched.ShortestGap(h.clock.Now(), scheduleCheckEvents); gap > 0 && gap < h.cfg.MinSubscriptionInterval {
+		errText := fmt.Sprintf(
+			"Scheduled pictures must be at least %s apart!",
+			time_string.ShortDur(h.cfg.MinSubscriptionInterval),
+		)
+
+		return errors.New(errText)
 	}
 
-	return inp, nil
+	return nil
+}
+
+// validateFilter checks that every category mentioned in the filter exists.
+func (h *Handler) validateFilter(ctx context.Context, filter domain.CategoryFilter) error {
+	categories := h.services.Image.GetCategories(ctx)
+
+	for _, category := range filter.Categories() {
+		if _, ok := categories[category]; !ok {
+			return fmt.Errorf("Unknown category: %s! Use /categories to list available ones.", category)
+		}
+	}
+
+	return nil
+}
+
+func isPeriodToken(token string) bool {
+	return token[0] >= '0' && token[0] <= '9'
+}
+
+// scheduleString describes when the subscription sends pictures.
+func scheduleString(sub domain.Subscription) string {
+	if !sub.Schedule.IsZero() {
+		return sub.Schedule.String()
+	}
+
+	return "every " + time_string.ShortDur(sub.PeriodAsDurationInSeconds())
+}
+
+// nextSend returns the moment the subscription actually sends the next picture taking quiet hours into account.
+func nextSend(sub domain.Subscription, quiet domain.QuietHours, now time.Time) time.Time {
+	next := sub.NextRun(now)
+
+	for i := 0; i < maxSkippedEvents && quiet.Contains(next); i++ {
+		if quiet.Policy != domain.QuietPolicySkip {
+			return quiet.End(next)
+		}
+
+		next = sub.NextRun(next)
+	}
+
+	return next
 }
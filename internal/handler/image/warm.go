@@ -0,0 +1,154 @@
+package image
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/webapi/tg_bot"
+	"apubot/pkg/utils/time_string"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"log"
+	"time"
+)
+
+// WarmCache uploads images without telegram id to the storage chat in background, so their first
+// recipients do not wait for upload. Ids are saved after every upload, so interrupted run continues
+// where it stopped when the command is sent again.
+func (h *Handler) WarmCache(ctx context.Context, message *tgbotapi.Message) {
+	chatId := message.Chat.ID
+
+	if h.cfg.Warm.StorageChatID == 0 {
+		h.api.SendMessage(ctx, chatId, "Storage chat is not configured, set warm.storage_chat_id first!")
+
+		return
+	}
+
+	if !h.warming.CompareAndSwap(false, true) {
+		h.api.SendMessage(ctx, chatId, "Images are already being uploaded, please wait :d")
+
+		return
+	}
+
+	files := h.services.Image.GetNotUploaded(ctx)
+	if len(files) == 0 {
+		h.warming.Store(false)
+		h.api.SendMessage(ctx, chatId, "Every image is already uploaded!")
+
+		return
+	}
+
+	eta := time.Duration(len(files)-1) * h.cfg.Warm.Interval
+	msgText := fmt.Sprintf(
+		"Uploading %d image(s) to the storage chat, it takes at least %s",
+		len(files), time_string.ShortDur(eta),
+	)
+	h.api.SendMessage(ctx, chatId, msgText)
+
+	h.warmers.Add(1)
+
+	go func() {
+		defer h.warmers.Done()
+		defer h.warming.Store(false)
+
+		h.warm(chatId, files)
+	}()
+}
+
+// warm uploads files one by one with a pause between them and reports the result to the chat.
+func (h *Handler) warm(chatId int64, files []domain.File) {
+	ctx := h.warmCtx
+
+	var uploaded, failed int
+	var stopReason string
+
+upload:
+	for i, file := range files {
+		if i > 0 {
+			timer := h.clock.NewTimer(h.cfg.Warm.Interval)
+
+			select {
+			case <-timer.C():
+			case <-ctx.Done():
+				timer.Stop()
+				stopReason = "bot is stopping"
+
+				break upload
+			}
+		}
+
+		err := h.uploadToStorage(ctx, file)
+
+		var permanentErr *tg_bot.PermanentError
+
+		switch {
+		case err == nil:
+			uploaded++
+		case ctx.Err() != nil:
+			stopReason = "bot is stopping"
+
+			break upload
+		case errors.As(err, &permanentErr):
+			log.Printf("Storage chat %d is unreachable: %v", h.cfg.Warm.StorageChatID, err)
+			stopReason = "storage chat is unreachable: " + permanentErr.Reason
+
+			break upload
+		default:
+			failed++
+			log.Printf("Can not upload %s to storage chat: %v", file.Name, err)
+		}
+	}
+
+	msgText := fmt.Sprintf("Upload finished: %d uploaded, %d failed.", uploaded, failed)
+	if stopReason != "" {
+		msgText = fmt.Sprintf(
+			"Upload interrupted as %s: %d uploaded, %d failed, %d left. Send /warm to continue.",
+			stopReason, uploaded, failed, len(files)-uploaded-failed,
+		)
+	}
+
+	log.Println(msgText)
+
+	// warm context may be cancelled already
+	reportCtx, cancel := context.WithTimeout(context.Background(), h.cfg.RequestTimeout)
+	defer cancel()
+
+	h.api.SendMessage(reportCtx, chatId, msgText)
+}
+
+func (h *Handler) uploadToStorage(ctx context.Context, file domain.File) error {
+	ctx, cancel := context.WithTimeout(ctx, h.cfg.UploadTimeout)
+	defer cancel()
+
+	attachment, err := h.createAttachment(file, h.cfg.Warm.StorageChatID)
+	if err != nil {
+		return err
+	}
+
+	res, err := h.api.SendAttachment(ctx, attachment)
+	if err != nil {
+		return err
+	}
+
+	h.updateFile(ctx, file, res)
+
+	return nil
+}
+
+// Stop interrupts running warm up and waits until it reports the result.
+func (h *Handler) Stop(ctx context.Context) error {
+	h.cancelWarm()
+
+	stopped := make(chan struct{})
+	go func() {
+		h.warmers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "images are still being uploaded")
+	}
+}
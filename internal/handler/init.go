@@ -2,20 +2,29 @@ package handler
 
 import (
 	"apubot/internal/config"
+	"apubot/internal/domain"
+	chatH "apubot/internal/handler/chat"
+	dialogH "apubot/internal/handler/dialog"
 	generalH "apubot/internal/handler/general"
 	imageH "apubot/internal/handler/image"
 	"apubot/internal/infrastructure/webapi"
 	"apubot/internal/service"
+	"apubot/pkg/utils/clock"
+	"context"
+	"github.com/pkg/errors"
 )
 
 type (
 	InitParams struct {
 		Config   *config.Config
 		APIs     *webapi.WebAPIs
+		Clock    clock.Clock
 		Services *service.Services
 	}
 
 	Handlers struct {
+		Chat    *chatH.Handler
+		Dialog  *dialogH.Handler
 		General *generalH.Handler
 		Image   *imageH.Handler
 	}
@@ -27,16 +36,51 @@ func New(p *InitParams) *Handlers {
 	imageHandler := imageH.New(
 		p.Config,
 		p.APIs.TgBot,
+		p.Clock,
 		&imageH.Services{
+			Chat:         p.Services.Chat,
+			Dialog:       p.Services.Dialog,
 			Image:        p.Services.Image,
 			Subscription: p.Services.Subscription,
 		},
 	)
 
+	chatHandler := chatH.New(
+		p.Config,
+		p.APIs.TgBot,
+		p.Clock,
+		&chatH.Services{
+			Chat:         p.Services.Chat,
+			Subscription: p.Services.Subscription,
+		},
+	)
+
+	dialogHandler := dialogH.New(
+		p.Config,
+		p.APIs.TgBot,
+		&dialogH.Services{
+			Dialog: p.Services.Dialog,
+		},
+	)
+
+	dialogHandler.Register(domain.DialogStateSubscriptionInput, imageHandler.SubscriptionInputStep)
+
 	handlers := &Handlers{
+		Chat:    chatHandler,
+		Dialog:  dialogHandler,
 		General: generalHandler,
 		Image:   imageHandler,
 	}
 
 	return handlers
 }
+
+// Stop ends background work started by handlers.
+func (h *Handlers) Stop(ctx context.Context) error {
+	err := h.Image.Stop(ctx)
+	if err != nil {
+		return errors.Wrap(err, "can not stop image handler")
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package chat
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"apubot/pkg/custom_errors"
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type Repository struct {
+	db *database.DB
+}
+
+func New(db *database.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Get(ctx context.Context, chatId int64) (chat domain.Chat, err error) {
+	query := `
+	SELECT chat_id, status, updated_at, timezone, quiet_from, quiet_to, quiet_policy
+	FROM chat WHERE chat_id = ?
+	`
+	err = r.db.Conn().QueryRowContext(ctx, query, chatId).Scan(
+		&chat.ChatId, &chat.Status, &chat.UpdatedAt, &chat.Timezone,
+		&chat.QuietHours.From, &chat.QuietHours.To, &chat.QuietHours.Policy,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return chat, custom_errors.NewNotFound("chat not found")
+	}
+
+	if err != nil {
+		return chat, errors.Wrap(err, "can not get chat")
+	}
+
+	return chat, nil
+}
+
+// Save updates bot membership status in the chat, chat settings are kept.
+func (r *Repository) Save(ctx context.Context, chat domain.Chat) error {
+	query := `
+	INSERT INTO chat (chat_id, status, updated_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET status=excluded.status, updated_at=excluded.updated_at
+	`
+	_, err := r.db.Conn().ExecContext(ctx, query, chat.ChatId, chat.Status, chat.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+func (r *Repository) SetTimezone(ctx context.Context, chatId int64, timezone string) error {
+	query := `
+	INSERT INTO chat (chat_id, status, updated_at, timezone)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET timezone=excluded.timezone
+	`
+	_, err := r.db.Conn().ExecContext(ctx, query, chatId, domain.ChatStatusMember, time.Now().Unix(), timezone)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+func (r *Repository) SetQuietHours(ctx context.Context, chatId int64, quiet domain.QuietHours) error {
+	query := `
+	INSERT INTO chat (chat_id, status, updated_at, quiet_from, quiet_to, quiet_policy)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET
+		quiet_from=excluded.quiet_from,
+		quiet_to=excluded.quiet_to,
+		quiet_policy=excluded.quiet_policy
+	`
+	_, err := r.db.Conn().ExecContext(
+		ctx, query,
+		chatId, domain.ChatStatusMember, time.Now().Unix(),
+		quiet.From, quiet.To, quiet.Policy,
+	)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package dialog
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"apubot/pkg/custom_errors"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/pkg/errors"
+)
+
+// Repository keeps dialogs in the database so they survive restarts.
+type Repository struct {
+	db *database.DB
+}
+
+func New(db *database.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Get(ctx context.Context, chatId int64) (session domain.DialogSession, err error) {
+	var data string
+
+	query := "SELECT chat_id, state, data, expires_at FROM dialog_session WHERE chat_id = ?"
+	err = r.db.Conn().QueryRowContext(ctx, query, chatId).Scan(
+		&session.ChatId, &session.State, &data, &session.ExpiresAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return session, custom_errors.NewNotFound("dialog not found")
+	}
+
+	if err != nil {
+		return session, errors.Wrap(err, "can not get dialog")
+	}
+
+	err = json.Unmarshal([]byte(data), &session.Data)
+	if err != nil {
+		return session, errors.Wrap(err, "can not decode dialog data")
+	}
+
+	return session, nil
+}
+
+func (r *Repository) Save(ctx context.Context, session domain.DialogSession) error {
+	data, err := json.Marshal(session.Data)
+	if err != nil {
+		return errors.Wrap(err, "can not encode dialog data")
+	}
+
+	query := `
+	INSERT INTO dialog_session (chat_id, state, data, expires_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET state=excluded.state, data=excluded.data, expires_at=excluded.expires_at
+	`
+	_, err = r.db.Conn().ExecContext(ctx, query, session.ChatId, session.State, string(data), session.ExpiresAt)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+func (r *Repository) Delete(ctx context.Context, chatId int64) error {
+	query := "DELETE FROM dialog_session WHERE chat_id = ?"
+	_, err := r.db.Conn().ExecContext(ctx, query, chatId)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+// DeleteExpired removes dialogs expired before the given unix time.
+func (r *Repository) DeleteExpired(ctx context.Context, now int64) error {
+	query := "DELETE FROM dialog_session WHERE expires_at <= ?"
+	_, err := r.db.Conn().ExecContext(ctx, query, now)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package dialog
+
+import (
+	"apubot/internal/domain"
+	"apubot/pkg/custom_errors"
+	"context"
+	"maps"
+	"sync"
+)
+
+// MemoryRepository keeps dialogs in memory, they are lost on restart.
+type MemoryRepository struct {
+	mu       sync.Mutex
+	sessions map[int64]domain.DialogSession
+}
+
+func NewMemory() *MemoryRepository {
+	return &MemoryRepository{sessions: make(map[int64]domain.DialogSession)}
+}
+
+func (r *MemoryRepository) Get(ctx context.Context, chatId int64) (session domain.DialogSession, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[chatId]
+	if !ok {
+		return session, custom_errors.NewNotFound("dialog not found")
+	}
+
+	// data is copied so callers can not change stored session
+	session.Data = maps.Clone(session.Data)
+
+	return session, nil
+}
+
+func (r *MemoryRepository) Save(ctx context.Context, session domain.DialogSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session.Data = maps.Clone(session.Data)
+	r.sessions[session.ChatId] = session
+
+	return nil
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, chatId int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.sessions, chatId)
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteExpired(ctx context.Context, now int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for chatId, session := range r.sessions {
+		if session.ExpiresAt <= now {
+			delete(r.sessions, chatId)
+		}
+	}
+
+	return nil
+}
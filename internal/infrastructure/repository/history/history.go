@@ -0,0 +1,81 @@
+package history
+
+import (
+	"apubot/internal/infrastructure/database"
+	"context"
+	"github.com/pkg/errors"
+)
+
+type Repository struct {
+	db *database.DB
+}
+
+func New(db *database.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// GetRecent returns names of images sent to the chat, most recent first.
+func (r *Repository) GetRecent(ctx context.Context, chatId int64, limit int) ([]string, error) {
+	query := `
+	SELECT image_name FROM sent_history
+	WHERE chat_id = ?
+	ORDER BY sent_at DESC, rowid DESC
+	LIMIT ?
+	`
+	rows, err := r.db.Conn().QueryContext(ctx, query, chatId, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	names := make([]string, 0, limit)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+		names = append(names, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return names, nil
+}
+
+// Add records the sent image and drops records of the chat beyond the keep most recent ones.
+func (r *Repository) Add(ctx context.Context, chatId int64, imageName string, sentAt int64, keep int) error {
+	tx, err := r.db.Conn().BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can not begin transaction")
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO sent_history (chat_id, image_name, sent_at) VALUES (?, ?, ?)"
+	_, err = tx.ExecContext(ctx, query, chatId, imageName, sentAt)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	query = `
+	DELETE FROM sent_history
+	WHERE chat_id = ? AND rowid NOT IN (
+		SELECT rowid FROM sent_history
+		WHERE chat_id = ?
+		ORDER BY sent_at DESC, rowid DESC
+		LIMIT ?
+	)
+	`
+	_, err = tx.ExecContext(ctx, query, chatId, chatId, keep)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can not commit transaction")
+	}
+
+	return nil
+}
@@ -15,21 +15,21 @@ func New(db *database.DB) *Repository {
 	return &Repository{db: db}
 }
 
-func (r *Repository) GetAll(ctx context.Context) (map[string]string, error) {
-	query := "SELECT name, tg_id FROM images"
+func (r *Repository) GetAll(ctx context.Context) (map[string]domain.File, error) {
+	query := "SELECT name, tg_id, category FROM images"
 	rows, err := r.db.Conn().QueryContext(ctx, query)
 	if err != nil {
 		return nil, errors.Wrap(err, "can not exec query")
 	}
 	defer rows.Close()
 
-	images := make(map[string]string)
+	images := make(map[string]domain.File)
 	for rows.Next() {
-		var name, tgID string
-		if err = rows.Scan(&name, &tgID); err != nil {
+		var file domain.File
+		if err = rows.Scan(&file.Name, &file.TgID, &file.Category); err != nil {
 			return nil, errors.Wrap(err, "can not scan row")
 		}
-		images[name] = tgID
+		images[file.Name] = file
 	}
 
 	if err = rows.Err(); err != nil {
@@ -39,12 +39,63 @@ func (r *Repository) GetAll(ctx context.Context) (map[string]string, error) {
 	return images, nil
 }
 
-func (r *Repository) SaveImage(ctx context.Context, file domain.File) error {
-	query := "INSERT INTO images (name, tg_id) VALUES (?, ?) ON CONFLICT(name) DO UPDATE SET tg_id=excluded.tg_id;"
-	_, err := r.db.Conn().ExecContext(ctx, query, file.Name, file.TgID)
+// UpdateTgID sets telegram id of the known image, unknown names are ignored.
+func (r *Repository) UpdateTgID(ctx context.Context, name string, tgID string) error {
+	query := "UPDATE images SET tg_id = ? WHERE name = ?"
+	_, err := r.db.Conn().ExecContext(ctx, query, tgID, name)
 	if err != nil {
 		return errors.Wrap(err, "can not exec query")
 	}
 
 	return nil
 }
+
+// AddImages inserts newly found images keeping telegram ids of already known ones.
+func (r *Repository) AddImages(ctx context.Context, files []domain.File) error {
+	tx, err := r.db.Conn().BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can not begin transaction")
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO images (name, category) VALUES (?, ?)
+	ON CONFLICT(name) DO UPDATE SET category=excluded.category;
+	`
+	for _, file := range files {
+		_, err = tx.ExecContext(ctx, query, file.Name, file.Category)
+		if err != nil {
+			return errors.Wrap(err, "can not exec query")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can not commit transaction")
+	}
+
+	return nil
+}
+
+func (r *Repository) DeleteImages(ctx context.Context, names []string) error {
+	tx, err := r.db.Conn().BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can not begin transaction")
+	}
+	defer tx.Rollback()
+
+	query := "DELETE FROM images WHERE name = ?"
+	for _, name := range names {
+		_, err = tx.ExecContext(ctx, query, name)
+		if err != nil {
+			return errors.Wrap(err, "can not exec query")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can not commit transaction")
+	}
+
+	return nil
+}
@@ -2,9 +2,14 @@ package repository
 
 import (
 	"apubot/internal/config"
+	"apubot/internal/domain"
 	"apubot/internal/infrastructure/database"
+	"apubot/internal/infrastructure/repository/chat"
+	"apubot/internal/infrastructure/repository/dialog"
+	"apubot/internal/infrastructure/repository/history"
 	"apubot/internal/infrastructure/repository/image"
 	"apubot/internal/infrastructure/repository/subscriprion"
+	"context"
 )
 
 type (
@@ -13,14 +18,33 @@ type (
 		DB     *database.DB
 	}
 
+	// DialogRepository is implemented by both in-memory and database dialog storages.
+	DialogRepository interface {
+		Get(ctx context.Context, chatId int64) (session domain.DialogSession, err error)
+		Save(ctx context.Context, session domain.DialogSession) error
+		Delete(ctx context.Context, chatId int64) error
+		DeleteExpired(ctx context.Context, now int64) error
+	}
+
 	Repositories struct {
+		Chat         *chat.Repository
+		Dialog       DialogRepository
+		History      *history.Repository
 		Image        *image.Repository
 		Subscription *subscriprion.Repository
 	}
 )
 
 func New(p *InitParams) *Repositories {
+	var dialogRepo DialogRepository = dialog.NewMemory()
+	if p.Config.Dialog.Storage == config.DialogStorageSQLite {
+		dialogRepo = dialog.New(p.DB)
+	}
+
 	return &Repositories{
+		Chat:         chat.New(p.DB),
+		Dialog:       dialogRepo,
+		History:      history.New(p.DB),
 		Image:        image.New(p.DB),
 		Subscription: subscriprion.New(p.DB),
 	}
@@ -3,21 +3,70 @@ package subscriprion
 import (
 	"apubot/internal/domain"
 	"apubot/internal/infrastructure/database"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/utils/schedule"
 	"context"
+	"database/sql"
 	"github.com/pkg/errors"
+	"strings"
 )
 
+const subscriptionColumns = "id, chat_id, name, created_at, period, schedule, paused, paused_until, " +
+	"include_categories, exclude_categories"
+
 type Repository struct {
 	db *database.DB
 }
 
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
 func New(db *database.DB) *Repository {
 	return &Repository{db: db}
 }
 
-func (r *Repository) Get(ctx context.Context, chatId int64) (sub domain.Subscription, err error) {
-	query := "SELECT chat_id, created_at, period FROM subscription WHERE chat_id = ?"
-	err = r.db.Conn().QueryRowContext(ctx, query, chatId).Scan(&sub.ChatId, &sub.CreatedAt, &sub.Period)
+func scanSubscription(row rowScanner) (sub domain.Subscription, err error) {
+	var spec, include, exclude string
+
+	err = row.Scan(
+		&sub.Id, &sub.ChatId, &sub.Name, &sub.CreatedAt, &sub.Period, &spec, &sub.Paused,
+		&sub.PausedUntil, &include, &exclude,
+	)
+	if err != nil {
+		return sub, err
+	}
+
+	if spec != "" {
+		sub.Schedule, err = schedule.Parse(spec)
+		if err != nil {
+			return sub, errors.Wrapf(err, "can not parse schedule of subscription %d", sub.Id)
+		}
+	}
+
+	sub.Filter = domain.CategoryFilter{
+		Include: splitList(include),
+		Exclude: splitList(exclude),
+	}
+
+	return sub, nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, ",")
+}
+
+func (r *Repository) Get(ctx context.Context, id int64) (sub domain.Subscription, err error) {
+	query := "SELECT " + subscriptionColumns + " FROM subscription WHERE id = ?"
+	sub, err = scanSubscription(r.db.Conn().QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return sub, custom_errors.NewNotFound("subscription not found")
+	}
+
 	if err != nil {
 		return sub, errors.Wrap(err, "can not get subscription")
 	}
@@ -25,18 +74,28 @@ func (r *Repository) Get(ctx context.Context, chatId int64) (sub domain.Subscrip
 	return sub, nil
 }
 
+func (r *Repository) GetByChat(ctx context.Context, chatId int64) (subs []domain.Subscription, err error) {
+	query := "SELECT " + subscriptionColumns + " FROM subscription WHERE chat_id = ? ORDER BY id"
+
+	return r.query(ctx, query, chatId)
+}
+
 func (r *Repository) GetAll(ctx context.Context) (subs []domain.Subscription, err error) {
-	query := "SELECT chat_id, created_at, period FROM subscription"
-	rows, err := r.db.Conn().QueryContext(ctx, query)
+	query := "SELECT " + subscriptionColumns + " FROM subscription"
+
+	return r.query(ctx, query)
+}
+
+func (r *Repository) query(ctx context.Context, query string, args ...any) (subs []domain.Subscription, err error) {
+	rows, err := r.db.Conn().QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, errors.Wrap(err, "can not exec query")
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var sub domain.Subscription
-
-		if err = rows.Scan(&sub.ChatId, &sub.CreatedAt, &sub.Period); err != nil {
+		sub, err := scanSubscription(rows)
+		if err != nil {
 			return nil, errors.Wrap(err, "can not scan row")
 		}
 
@@ -50,13 +109,52 @@ func (r *Repository) GetAll(ctx context.Context) (subs []domain.Subscription, er
 	return subs, nil
 }
 
-func (r *Repository) Create(ctx context.Context, sub domain.Subscription) error {
+// Create inserts the subscription or replaces the one with the same name in the chat, returns its id.
+func (r *Repository) Create(ctx context.Context, sub domain.Subscription) (id int64, err error) {
 	query := `
-	INSERT INTO subscription (chat_id, created_at, period)
-	VALUES (?, ?, ?)
-	ON CONFLICT(chat_id) DO UPDATE SET created_at=excluded.created_at, period=excluded.period
+	INSERT INTO subscription (
+		chat_id, name, created_at, period, schedule, paused, paused_until, include_categories, exclude_categories
+	)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(chat_id, name) DO UPDATE SET
+		created_at=excluded.created_at,
+		period=excluded.period,
+		schedule=excluded.schedule,
+		paused=excluded.paused,
+		paused_until=excluded.paused_until,
+		include_categories=excluded.include_categories,
+		exclude_categories=excluded.exclude_categories
+	RETURNING id
 	`
-	_, err := r.db.Conn().ExecContext(ctx, query, sub.ChatId, sub.CreatedAt, sub.Period)
+	err = r.db.Conn().QueryRowContext(
+		ctx, query,
+		sub.ChatId, sub.Name, sub.CreatedAt, sub.Period, sub.Schedule.String(), sub.Paused, sub.PausedUntil,
+		strings.Join(sub.Filter.Include, ","), strings.Join(sub.Filter.Exclude, ","),
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not exec query")
+	}
+
+	return id, nil
+}
+
+// SetPaused changes paused state of the subscription, until is unix time of auto resume or zero.
+func (r *Repository) SetPaused(ctx context.Context, id int64, paused bool, until int64) error {
+	query := "UPDATE subscription SET paused = ?, paused_until = ? WHERE id = ?"
+	_, err := r.db.Conn().ExecContext(ctx, query, paused, until, id)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+func (r *Repository) SetFilter(ctx context.Context, id int64, filter domain.CategoryFilter) error {
+	query := "UPDATE subscription SET include_categories = ?, exclude_categories = ? WHERE id = ?"
+	_, err := r.db.Conn().ExecContext(
+		ctx, query,
+		strings.Join(filter.Include, ","), strings.Join(filter.Exclude, ","), id,
+	)
 	if err != nil {
 		return errors.Wrap(err, "can not exec query")
 	}
@@ -64,9 +162,9 @@ func (r *Repository) Create(ctx context.Context, sub domain.Subscription) error
 	return nil
 }
 
-func (r *Repository) Delete(ctx context.Context, chatId int64) error {
-	query := "DELETE FROM subscription WHERE chat_id = ?"
-	_, err := r.db.Conn().ExecContext(ctx, query, chatId)
+func (r *Repository) Delete(ctx context.Context, id int64) error {
+	query := "DELETE FROM subscription WHERE id = ?"
+	_, err := r.db.Conn().ExecContext(ctx, query, id)
 	if err != nil {
 		return errors.Wrap(err, "can not exec query")
 	}
@@ -2,16 +2,23 @@ package tg_bot
 
 import (
 	"apubot/internal/config"
+	"context"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
 	"log"
+	"net/http"
+	"time"
 )
 
 type BotAPI struct {
-	bot *tgbotapi.BotAPI
+	cfg     *config.Config
+	bot     *tgbotapi.BotAPI
+	limiter *limiter
+	webhook *webhook
 }
 
 func New(cfg *config.Config) *BotAPI {
-	bot, err := tgbotapi.NewBotAPI(cfg.ApiKey)
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(cfg.ApiKey, cfg.ApiEndpoint)
 	if err != nil {
 		log.Fatalf("Error creating bot: %v", err)
 	}
@@ -19,19 +26,129 @@ func New(cfg *config.Config) *BotAPI {
 	bot.Debug = cfg.IsDebug
 
 	return &BotAPI{
-		bot: bot,
+		cfg:     cfg,
+		bot:     bot,
+		limiter: newLimiter(cfg.RateLimit),
 	}
 }
 
-func (b *BotAPI) SendMessage(chatID int64, message string) {
-	_, err := b.bot.Send(tgbotapi.NewMessage(chatID, message))
+// ctxClient binds requests made by tgbotapi, which knows nothing about contexts, to the context.
+type ctxClient struct {
+	ctx    context.Context
+	client tgbotapi.HTTPClient
+}
+
+func (c ctxClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(c.ctx))
+}
+
+// withContext returns a copy of the bot whose requests are cancelled together with ctx.
+func (b *BotAPI) withContext(ctx context.Context) *tgbotapi.BotAPI {
+	bot := *b.bot
+	bot.Client = ctxClient{ctx: ctx, client: b.bot.Client}
+
+	return &bot
+}
+
+// wait sleeps for the duration unless ctx is done earlier.
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send waits for a free slot according to telegram rate limits and sends the message.
+// Requests rejected with retry_after are queued again instead of failing.
+// Returned errors are always one of PermanentError, RateLimitedError or TransientError,
+// the latter wraps ctx error when ctx is done before the message is sent.
+// RateLimitedError is returned right away when the message can not be sent before ctx deadline.
+func (b *BotAPI) send(ctx context.Context, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	chatID := chatIDOf(c)
+
+	deadline, _ := ctx.Deadline()
+
+	for attempt := 0; ; attempt++ {
+		at, ok := b.limiter.reserve(chatID, deadline)
+		delay := time.Until(at)
+
+		if !ok {
+			return tgbotapi.Message{}, &RateLimitedError{
+				RetryAfter: delay,
+				Err:        errors.Errorf("can not send to chat %d in %s before the deadline", chatID, delay),
+			}
+		}
+
+		err := wait(ctx, delay)
+		if err != nil {
+			b.limiter.release(chatID, at)
+
+			return tgbotapi.Message{}, &TransientError{Err: err}
+		}
+
+		res, err := b.withContext(ctx).Send(c)
+		err = classifyError(err)
+
+		var rateErr *RateLimitedError
+		if !errors.As(err, &rateErr) || attempt >= b.cfg.RateLimit.MaxRetries {
+			return res, err
+		}
+
+		log.Printf("Rate limited sending to chat %d, retrying in %s", chatID, rateErr.RetryAfter)
+
+		b.limiter.penalize(chatID, rateErr.RetryAfter)
+	}
+}
+
+func (b *BotAPI) SendMessage(ctx context.Context, chatID int64, message string) {
+	_, err := b.send(ctx, tgbotapi.NewMessage(chatID, message))
 	if err != nil {
 		log.Printf("Error sending message: %v", err)
 	}
 }
 
-func (b *BotAPI) SendAttachment(attachment tgbotapi.Chattable) (res tgbotapi.Message, err error) {
-	res, err = b.bot.Send(attachment)
+func (b *BotAPI) SendKeyboard(
+	ctx context.Context,
+	chatID int64,
+	message string,
+	keyboard tgbotapi.InlineKeyboardMarkup,
+) {
+	msg := tgbotapi.NewMessage(chatID, message)
+	msg.ReplyMarkup = keyboard
+
+	_, err := b.send(ctx, msg)
+	if err != nil {
+		log.Printf("Error sending keyboard: %v", err)
+	}
+}
+
+// EditMessage replaces text of the sent message removing its inline keyboard.
+func (b *BotAPI) EditMessage(ctx context.Context, chatID int64, messageID int, message string) {
+	_, err := b.send(ctx, tgbotapi.NewEditMessageText(chatID, messageID, message))
+	if err != nil {
+		log.Printf("Error editing message: %v", err)
+	}
+}
+
+// AnswerCallback stops the loading animation on the pressed button, non-empty text is shown as a notification.
+func (b *BotAPI) AnswerCallback(ctx context.Context, callbackID string, text string) {
+	_, err := b.withContext(ctx).Request(tgbotapi.NewCallback(callbackID, text))
+	if err != nil {
+		log.Printf("Error answering callback: %v", err)
+	}
+}
+
+func (b *BotAPI) SendAttachment(ctx context.Context, attachment tgbotapi.Chattable) (res tgbotapi.Message, err error) {
+	res, err = b.send(ctx, attachment)
 	if err != nil {
 		log.Printf("Error sending attachment: %v", err)
 
@@ -41,15 +158,80 @@ func (b *BotAPI) SendAttachment(attachment tgbotapi.Chattable) (res tgbotapi.Mes
 	return res, nil
 }
 
-func (b *BotAPI) GetUpdatesChan() tgbotapi.UpdatesChannel {
+// SetCommands registers the command menu shown by telegram clients in the scope,
+// empty language code sets the menu for users without a dedicated one.
+func (b *BotAPI) SetCommands(
+	ctx context.Context,
+	scope tgbotapi.BotCommandScope,
+	languageCode string,
+	commands []tgbotapi.BotCommand,
+) error {
+	_, err := b.withContext(ctx).Request(tgbotapi.NewSetMyCommandsWithScopeAndLanguage(scope, languageCode, commands...))
+	if err != nil {
+		return errors.Wrap(err, "can not set bot commands")
+	}
+
+	return nil
+}
+
+// GetUpdatesChan starts receiving updates by polling or webhook, according to config.
+func (b *BotAPI) GetUpdatesChan() (tgbotapi.UpdatesChannel, error) {
+	if b.cfg.UpdatesMode == config.UpdatesModeWebhook {
+		return b.listenForWebhook()
+	}
+
+	// getUpdates is refused with 409 while a webhook left from webhook mode is set
+	_, err := b.bot.Request(tgbotapi.DeleteWebhookConfig{})
+	if err != nil {
+		return nil, errors.Wrap(err, "can not delete webhook")
+	}
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
-	return b.bot.GetUpdatesChan(u)
+	return b.bot.GetUpdatesChan(u), nil
+}
+
+func (b *BotAPI) listenForWebhook() (tgbotapi.UpdatesChannel, error) {
+	wh, err := newWebhook(b.cfg.Webhook.URL, b.cfg.Webhook.ListenAddr, b.cfg.Webhook.SecretToken, b.bot.Buffer)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not create webhook")
+	}
+
+	wh.listen()
+
+	params := tgbotapi.Params{
+		"url":          b.cfg.Webhook.URL,
+		"secret_token": b.cfg.Webhook.SecretToken,
+	}
+
+	_, err = b.bot.MakeRequest("setWebhook", params)
+	if err != nil {
+		wh.shutdown()
+
+		return nil, errors.Wrap(err, "can not set webhook")
+	}
+
+	log.Printf("Webhook registered at %s", b.cfg.Webhook.URL)
+
+	b.webhook = wh
+
+	return wh.updates, nil
 }
 
 func (b *BotAPI) Shutdown() {
 	log.Println("Stopping bot...")
 
-	b.bot.StopReceivingUpdates()
+	if b.webhook == nil {
+		b.bot.StopReceivingUpdates()
+
+		return
+	}
+
+	_, err := b.bot.Request(tgbotapi.DeleteWebhookConfig{})
+	if err != nil {
+		log.Printf("Error deleting webhook: %v", err)
+	}
+
+	b.webhook.shutdown()
 }
@@ -0,0 +1,90 @@
+package tg_bot
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/testutil"
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestBot(t *testing.T, fake *testutil.FakeBotAPI) *BotAPI {
+	t.Helper()
+
+	return New(&config.Config{
+		ApiKey:      testutil.FakeBotToken,
+		ApiEndpoint: fake.Endpoint(),
+		RateLimit: config.RateLimitConfig{
+			GlobalPerSecond: config.DefaultGlobalSendsPerSecond,
+			MaxRetries:      config.DefaultRateLimitMaxRetries,
+		},
+	})
+}
+
+func TestSendRetriesAfterRateLimit(t *testing.T) {
+	fake := testutil.NewFakeBotAPI()
+	defer fake.Close()
+
+	bot := newTestBot(t, fake)
+	fake.RateLimitNext("sendMessage", time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := bot.send(ctx, tgbotapi.NewMessage(7, "hi"))
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if calls := fake.Calls("sendMessage"); len(calls) != 2 {
+		t.Errorf("sendMessage called %d times, want 2", len(calls))
+	}
+}
+
+func TestSendRateLimitedPastDeadline(t *testing.T) {
+	fake := testutil.NewFakeBotAPI()
+	defer fake.Close()
+
+	bot := newTestBot(t, fake)
+	fake.RateLimitNext("sendMessage", 2*time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+
+	_, err := bot.send(ctx, tgbotapi.NewMessage(7, "hi"))
+
+	var rateErr *RateLimitedError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("send error = %v, want RateLimitedError", err)
+	}
+
+	if rateErr.RetryAfter < time.Second {
+		t.Errorf("RetryAfter = %s, want about 2s", rateErr.RetryAfter)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("send returned after %s, want right away", elapsed)
+	}
+}
+
+func TestGetUpdatesChanReportsDeleteWebhookError(t *testing.T) {
+	fake := testutil.NewFakeBotAPI()
+	defer fake.Close()
+
+	bot := newTestBot(t, fake)
+	fake.FailNext("deleteWebhook", http.StatusBadGateway, "Bad Gateway")
+
+	_, err := bot.GetUpdatesChan()
+	if err == nil {
+		t.Fatal("GetUpdatesChan succeeded, want deleteWebhook error")
+	}
+
+	if calls := fake.Calls("getUpdates"); len(calls) > 0 {
+		t.Errorf("polling started after failed deleteWebhook: %+v", calls)
+	}
+}
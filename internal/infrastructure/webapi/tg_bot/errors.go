@@ -0,0 +1,114 @@
+package tg_bot
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// permanentDescriptions are parts of telegram error descriptions
+// meaning the chat will never accept messages from the bot again.
+var permanentDescriptions = []string{
+	"bot was blocked by the user",
+	"bot was kicked",
+	"bot is not a member",
+	"user is deactivated",
+	"chat not found",
+	"group chat was upgraded to a supergroup",
+	"have no rights to send",
+	"not enough rights to send",
+	"chat_write_forbidden",
+	"peer_id_invalid",
+}
+
+// invalidFileIDDescriptions are parts of telegram error descriptions
+// meaning the file_id can not be used by the bot and the file has to be uploaded again.
+var invalidFileIDDescriptions = []string{
+	"wrong file identifier",
+	"wrong remote file identifier",
+	"file reference",
+}
+
+type (
+	// PermanentError means the chat can not receive messages anymore:
+	// the bot was blocked, kicked or the chat was deleted.
+	PermanentError struct {
+		Reason string
+		Err    error
+	}
+
+	// RateLimitedError means telegram asked to wait before the next request.
+	RateLimitedError struct {
+		RetryAfter time.Duration
+		Err        error
+	}
+
+	// TransientError is any other failure worth retrying later.
+	TransientError struct {
+		Err error
+	}
+)
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+func (e *RateLimitedError) Error() string { return e.Err.Error() }
+
+func (e *RateLimitedError) Unwrap() error { return e.Err }
+
+func (e *TransientError) Error() string { return e.Err.Error() }
+
+func (e *TransientError) Unwrap() error { return e.Err }
+
+// classifyError wraps errors returned by telegram into one of the typed errors above.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		// network failures, timeouts, unexpected responses
+		return &TransientError{Err: err}
+	}
+
+	if tgErr.Code == http.StatusTooManyRequests || tgErr.RetryAfter > 0 {
+		return &RateLimitedError{
+			RetryAfter: time.Duration(tgErr.RetryAfter) * time.Second,
+			Err:        err,
+		}
+	}
+
+	if tgErr.Code == http.StatusForbidden {
+		return &PermanentError{Reason: tgErr.Message, Err: err}
+	}
+
+	description := strings.ToLower(tgErr.Message)
+	for _, d := range permanentDescriptions {
+		if strings.Contains(description, d) {
+			return &PermanentError{Reason: tgErr.Message, Err: err}
+		}
+	}
+
+	return &TransientError{Err: err}
+}
+
+// IsInvalidFileID reports whether the request failed because telegram does not accept the file_id it referred to.
+func IsInvalidFileID(err error) bool {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return false
+	}
+
+	description := strings.ToLower(tgErr.Message)
+	for _, d := range invalidFileIDDescriptions {
+		if strings.Contains(description, d) {
+			return true
+		}
+	}
+
+	return false
+}
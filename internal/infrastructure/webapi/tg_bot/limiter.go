@@ -0,0 +1,147 @@
+package tg_bot
+
+import (
+	"apubot/internal/config"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"sync"
+	"time"
+)
+
+const limiterSweepInterval = time.Minute
+
+// limiter hands out send slots respecting both global and per-chat telegram limits.
+// Every caller reserves the earliest free slot, so concurrent sends are queued in order.
+type limiter struct {
+	mu            sync.Mutex
+	globalGap     time.Duration
+	chatGap       time.Duration
+	groupGap      time.Duration
+	nextGlobal    time.Time
+	nextChat      map[int64]time.Time
+	lastSweepTime time.Time
+}
+
+func newLimiter(cfg config.RateLimitConfig) *limiter {
+	return &limiter{
+		globalGap:     time.Second / time.Duration(cfg.GlobalPerSecond),
+		chatGap:       cfg.ChatInterval,
+		groupGap:      cfg.GroupChatInterval,
+		nextChat:      make(map[int64]time.Time),
+		lastSweepTime: time.Now(),
+	}
+}
+
+// reserve books the next send slot for the chat unless it is later than the deadline, zero deadline means no limit.
+// Returns the slot and whether it was booked, slots past the deadline are left for other senders.
+func (l *limiter) reserve(chatID int64, deadline time.Time) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	at := now
+	if l.nextGlobal.After(at) {
+		at = l.nextGlobal
+	}
+
+	if next, ok := l.nextChat[chatID]; ok && next.After(at) {
+		at = next
+	}
+
+	if !deadline.IsZero() && at.After(deadline) {
+		return at, false
+	}
+
+	l.nextGlobal = at.Add(l.globalGap)
+
+	if chatID != 0 {
+		l.nextChat[chatID] = at.Add(l.chatInterval(chatID))
+	}
+
+	return at, true
+}
+
+// release gives back the slot booked by reserve when nothing was sent in it.
+// The slot can only be returned while no later one is booked, otherwise it is just wasted.
+func (l *limiter) release(chatID int64, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.nextGlobal.Equal(at.Add(l.globalGap)) {
+		l.nextGlobal = at
+	}
+
+	if chatID == 0 {
+		return
+	}
+
+	if next, ok := l.nextChat[chatID]; ok && next.Equal(at.Add(l.chatInterval(chatID))) {
+		l.nextChat[chatID] = at
+	}
+}
+
+// penalize holds every send for the duration requested by telegram in retry_after,
+// flood limits of the bot are not per chat only.
+func (l *limiter) penalize(chatID int64, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(retryAfter)
+
+	if until.After(l.nextGlobal) {
+		l.nextGlobal = until
+	}
+
+	if chatID == 0 {
+		return
+	}
+
+	if next := l.nextChat[chatID]; until.After(next) {
+		l.nextChat[chatID] = until
+	}
+}
+
+func (l *limiter) chatInterval(chatID int64) time.Duration {
+	// group and channel ids are negative
+	if chatID < 0 {
+		return l.groupGap
+	}
+
+	return l.chatGap
+}
+
+// sweep drops chats without pending reservations, must be called with mu held.
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweepTime) < limiterSweepInterval {
+		return
+	}
+
+	for chatID, next := range l.nextChat {
+		if next.Before(now) {
+			delete(l.nextChat, chatID)
+		}
+	}
+
+	l.lastSweepTime = now
+}
+
+// chatIDOf extracts the target chat of outgoing messages, 0 means unknown.
+func chatIDOf(c tgbotapi.Chattable) int64 {
+	switch v := c.(type) {
+	case tgbotapi.MessageConfig:
+		return v.ChatID
+	case tgbotapi.PhotoConfig:
+		return v.ChatID
+	case tgbotapi.DocumentConfig:
+		return v.ChatID
+	case tgbotapi.AnimationConfig:
+		return v.ChatID
+	case tgbotapi.VideoConfig:
+		return v.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return v.ChatID
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,75 @@
+package tg_bot
+
+import (
+	"apubot/internal/config"
+	"testing"
+	"time"
+)
+
+func newTestLimiter() *limiter {
+	return newLimiter(config.RateLimitConfig{
+		GlobalPerSecond:   config.DefaultGlobalSendsPerSecond,
+		ChatInterval:      config.DefaultChatSendInterval,
+		GroupChatInterval: config.DefaultGroupChatSendInterval,
+	})
+}
+
+func TestPenalizeHoldsEveryChat(t *testing.T) {
+	l := newTestLimiter()
+
+	l.penalize(7, 2*time.Second)
+
+	if at, _ := l.reserve(8, time.Time{}); time.Until(at) < time.Second {
+		t.Errorf("other chat waits %s after rate limit, want about 2s", time.Until(at))
+	}
+
+	if at, _ := l.reserve(7, time.Time{}); time.Until(at) < time.Second {
+		t.Errorf("rate limited chat waits %s, want about 2s", time.Until(at))
+	}
+}
+
+func TestPenalizeUnknownChat(t *testing.T) {
+	l := newTestLimiter()
+
+	l.penalize(0, 2*time.Second)
+
+	if _, ok := l.nextChat[0]; ok {
+		t.Error("penalty of unknown chat is kept as a chat limit")
+	}
+}
+
+func TestReservePastDeadlineKeepsSlots(t *testing.T) {
+	l := newTestLimiter()
+
+	if _, ok := l.reserve(7, time.Time{}); !ok {
+		t.Fatal("first send is not reserved")
+	}
+
+	// the chat interval makes every next send to the chat miss the deadline
+	for i := 0; i < 100; i++ {
+		if _, ok := l.reserve(7, time.Now().Add(10*time.Millisecond)); ok {
+			t.Fatalf("send %d is reserved past the deadline", i)
+		}
+	}
+
+	at, ok := l.reserve(8, time.Time{})
+	if !ok {
+		t.Fatal("send to other chat is not reserved")
+	}
+
+	if delay := time.Until(at); delay > 2*l.globalGap {
+		t.Errorf("other chat waits %s after rejected sends, want at most %s", delay, 2*l.globalGap)
+	}
+}
+
+func TestReleaseReturnsSlot(t *testing.T) {
+	l := newTestLimiter()
+
+	at, _ := l.reserve(7, time.Time{})
+	l.release(7, at)
+
+	// without the release the chat would wait for its interval
+	if next, _ := l.reserve(7, time.Time{}); time.Until(next) > l.globalGap {
+		t.Errorf("released slot is not reused, next send waits %s", time.Until(next))
+	}
+}
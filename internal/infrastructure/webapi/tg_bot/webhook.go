@@ -0,0 +1,113 @@
+package tg_bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+const webhookShutdownTimeout = 5 * time.Second
+
+type webhook struct {
+	server  *http.Server
+	secret  string
+	updates chan tgbotapi.Update
+}
+
+func newWebhook(rawURL, listenAddr, secret string, buffer int) (*webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not parse webhook url")
+	}
+
+	pattern := u.Path
+	if pattern == "" {
+		pattern = "/"
+	}
+
+	w := &webhook{
+		secret:  secret,
+		updates: make(chan tgbotapi.Update, buffer),
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(pattern, w)
+
+	w.server = &http.Server{
+		Addr:              listenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return w, nil
+}
+
+func (w *webhook) listen() {
+	go func() {
+		log.Printf("Listening for webhook updates on %s", w.server.Addr)
+
+		err := w.server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Error serving webhook: %v", err)
+		}
+	}()
+}
+
+// ServeHTTP accepts a single update pushed by Telegram.
+func (w *webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	token := r.Header.Get(secretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(w.secret)) != 1 {
+		rw.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	var update tgbotapi.Update
+
+	err := json.NewDecoder(r.Body).Decode(&update)
+	if err != nil {
+		log.Printf("Error decoding webhook update: %v", err)
+		rw.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	select {
+	case w.updates <- update:
+		rw.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		// telegram will redeliver the update later
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// shutdown stops accepting requests and closes the updates channel
+// once all in-flight requests are done.
+func (w *webhook) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+	defer cancel()
+
+	err := w.server.Shutdown(ctx)
+	if err != nil {
+		// some requests may still be writing to the channel, leave it open
+		log.Printf("Error stopping webhook server: %v", err)
+
+		return
+	}
+
+	close(w.updates)
+}
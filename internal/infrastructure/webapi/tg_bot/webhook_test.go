@@ -0,0 +1,100 @@
+package tg_bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSecret = "test-secret"
+
+func newTestWebhook(t *testing.T) *webhook {
+	t.Helper()
+
+	w, err := newWebhook("https://example.com/webhook", "127.0.0.1:0", testSecret, 1)
+	if err != nil {
+		t.Fatalf("newWebhook: %v", err)
+	}
+
+	return w
+}
+
+func TestWebhookServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		secret     string
+		body       string
+		wantStatus int
+		wantUpdate bool
+	}{
+		{
+			name:       "valid update",
+			method:     http.MethodPost,
+			secret:     testSecret,
+			body:       `{"update_id":42,"message":{"message_id":1,"chat":{"id":7},"text":"/peepo"}}`,
+			wantStatus: http.StatusOK,
+			wantUpdate: true,
+		},
+		{
+			name:       "wrong secret",
+			method:     http.MethodPost,
+			secret:     "wrong",
+			body:       `{"update_id":42}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing secret",
+			method:     http.MethodPost,
+			body:       `{"update_id":42}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "not post",
+			method:     http.MethodGet,
+			secret:     testSecret,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "malformed json",
+			method:     http.MethodPost,
+			secret:     testSecret,
+			body:       `{"update_id":`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWebhook(t)
+
+			req := httptest.NewRequest(tt.method, "/webhook", strings.NewReader(tt.body))
+			if tt.secret != "" {
+				req.Header.Set(secretTokenHeader, tt.secret)
+			}
+
+			rec := httptest.NewRecorder()
+			w.server.Handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			select {
+			case update := <-w.updates:
+				if !tt.wantUpdate {
+					t.Fatalf("unexpected update %d delivered", update.UpdateID)
+				}
+
+				if update.UpdateID != 42 || update.Message == nil || update.Message.Text != "/peepo" {
+					t.Errorf("delivered update = %+v, want update 42 with /peepo", update)
+				}
+			default:
+				if tt.wantUpdate {
+					t.Fatal("update was not delivered")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"apubot/internal/server/router"
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+)
+
+// registerCommands describes every command of the bot, help and telegram menu are built from it.
+func (s *Server) registerCommands() {
+	commands := []*router.Command{
+		{
+			Name:         StartCommand,
+			Description:  "Start using the bot",
+			Descriptions: map[string]string{"ru": "Начать пользоваться ботом"},
+			Handler: func(ctx context.Context, message *tgbotapi.Message) {
+				s.handlers.General.StartResponse(ctx, message.Chat.ID)
+			},
+			GroupAllowed: true,
+			Hidden:       true,
+		},
+		{
+			Name:         PeepoCommand,
+			Args:         "[category]",
+			Description:  "Get random picture, optionally from category",
+			Descriptions: map[string]string{"ru": "Случайная картинка, можно указать категорию"},
+			Handler:      s.handlers.Image.GetImage,
+			Timeout:      s.cfg.UploadTimeout,
+			GroupAllowed: true,
+		},
+		{
+			Name:         CategoriesCommand,
+			Description:  "List picture categories",
+			Descriptions: map[string]string{"ru": "Список категорий картинок"},
+			Handler:      s.handlers.Image.GetCategories,
+			GroupAllowed: true,
+		},
+		{
+			Name:         SubscribeCommand,
+			Args:         "[name]",
+			Description:  "Subscribe to receive pictures periodically or on schedule, name lets chat have several subscriptions, use name=<name> when it is also a category",
+			Descriptions: map[string]string{"ru": "Подписаться на картинки, имя позволяет завести несколько подписок"},
+			Handler:      s.handlers.Image.CreateSubscription,
+			GroupAllowed: true,
+		},
+		{
+			Name:         SubscriptionFilterCommand,
+			Args:         "[name] <categories>",
+			Description:  "Choose categories of subscription pictures",
+			Descriptions: map[string]string{"ru": "Выбрать категории картинок подписки"},
+			Handler:      s.handlers.Image.SetSubscriptionFilter,
+			GroupAllowed: true,
+		},
+		{
+			Name:         SubscriptionInfoCommand,
+			Description:  "Get info about chat subscriptions",
+			Descriptions: map[string]string{"ru": "Информация о подписках чата"},
+			Handler:      s.handlers.Image.GetSubscription,
+			GroupAllowed: true,
+		},
+		{
+			Name:         UnsubscribeCommand,
+			Args:         "[name]",
+			Description:  "Drop one of chat subscriptions",
+			Descriptions: map[string]string{"ru": "Удалить одну из подписок чата"},
+			Handler:      s.handlers.Image.DeleteSubscription,
+			GroupAllowed: true,
+		},
+		{
+			Name:         PauseCommand,
+			Args:         "[duration]",
+			Description:  "Pause subscriptions, like /pause 2d, or until resumed",
+			Descriptions: map[string]string{"ru": "Приостановить подписки, например /pause 2d, или до /resume"},
+			Handler:      s.handlers.Image.PauseSubscription,
+			GroupAllowed: true,
+		},
+		{
+			Name:         ResumeCommand,
+			Description:  "Resume paused subscriptions",
+			Descriptions: map[string]string{"ru": "Возобновить приостановленные подписки"},
+			Handler:      s.handlers.Image.ResumeSubscription,
+			GroupAllowed: true,
+		},
+		{
+			Name:         TimezoneCommand,
+			Args:         "[zone]",
+			Description:  "Show or set chat time zone, like Europe/Berlin",
+			Descriptions: map[string]string{"ru": "Показать или задать часовой пояс чата, например Europe/Moscow"},
+			Handler:      s.handlers.Chat.SetTimezone,
+			GroupAllowed: true,
+		},
+		{
+			Name:         QuietHoursCommand,
+			Args:         "[from-to [defer|skip]|off]",
+			Description:  "Show or set hours when scheduled pictures are not sent",
+			Descriptions: map[string]string{"ru": "Показать или задать тихие часы без картинок по расписанию"},
+			Handler:      s.handlers.Chat.SetQuietHours,
+			GroupAllowed: true,
+		},
+		{
+			Name:         CancelCommand,
+			Description:  "Cancel the command waiting for your input",
+			Descriptions: map[string]string{"ru": "Отменить команду, ожидающую ввода"},
+			Handler:      s.handlers.Dialog.Cancel,
+			GroupAllowed: true,
+			NoCooldown:   true,
+		},
+		{
+			Name:         WarmCommand,
+			Description:  "Upload images not sent yet to the storage chat",
+			Descriptions: map[string]string{"ru": "Загрузить ещё не отправленные картинки в чат-хранилище"},
+			Handler:      s.handlers.Image.WarmCache,
+			AdminOnly:    true,
+		},
+		{
+			Name:         HelpCommand,
+			Description:  "Get this list",
+			Descriptions: map[string]string{"ru": "Показать этот список"},
+			Handler:      s.help,
+			GroupAllowed: true,
+		},
+	}
+
+	for _, cmd := range commands {
+		s.router.Register(cmd)
+	}
+}
+
+// help lists commands available in the chat.
+func (s *Server) help(ctx context.Context, message *tgbotapi.Message) {
+	admin := router.IsAdmin(s.cfg.AdminIDs, message)
+	group := !message.Chat.IsPrivate()
+
+	var lang string
+	if message.From != nil {
+		lang = message.From.LanguageCode
+	}
+
+	var lines []string
+	for _, cmd := range s.router.Commands(admin, group) {
+		lines = append(lines, cmd.Usage()+" - "+cmd.DescriptionFor(lang))
+	}
+
+	s.handlers.General.HelpResponse(ctx, message.Chat.ID, lines)
+}
+
+func (s *Server) unknownCommand(ctx context.Context, message *tgbotapi.Message) {
+	s.handlers.General.MessageResponse(ctx, message.Chat.ID, "Unknown command")
+}
+
+// setBotCommands registers command menus shown by telegram clients: the default one, one for group chats
+// and one with admin commands for every admin chat, each of them in every language commands are localized to.
+func (s *Server) setBotCommands(ctx context.Context) {
+	type menu struct {
+		scope tgbotapi.BotCommandScope
+		admin bool
+		group bool
+	}
+
+	menus := []menu{
+		{scope: tgbotapi.NewBotCommandScopeDefault()},
+		{scope: tgbotapi.NewBotCommandScopeAllGroupChats(), group: true},
+	}
+
+	for _, id := range s.cfg.AdminIDs {
+		menus = append(menus, menu{scope: tgbotapi.NewBotCommandScopeChat(id), admin: true, group: id < 0})
+	}
+
+	languages := append([]string{""}, s.router.Languages()...)
+
+	for _, m := range menus {
+		for _, lang := range languages {
+			var botCommands []tgbotapi.BotCommand
+			for _, cmd := range s.router.Commands(m.admin, m.group) {
+				botCommands = append(botCommands, tgbotapi.BotCommand{
+					Command:     cmd.Name,
+					Description: cmd.DescriptionFor(lang),
+				})
+			}
+
+			reqCtx, cancel := context.WithTimeout(ctx, s.cfg.RequestTimeout)
+			err := s.api.SetCommands(reqCtx, m.scope, lang, botCommands)
+			cancel()
+
+			if err != nil {
+				log.Printf("Error registering bot commands for scope %s %q: %v", m.scope.Type, lang, err)
+			}
+		}
+	}
+}
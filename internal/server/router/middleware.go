@@ -0,0 +1,121 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/patrickmn/go-cache"
+	"log"
+	"runtime/debug"
+	"slices"
+	"time"
+)
+
+// ReplyFunc sends a text message to the chat.
+type ReplyFunc func(ctx context.Context, chatID int64, message string)
+
+// Logging logs every handled command with its duration.
+func Logging() Middleware {
+	return func(cmd *Command, next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message *tgbotapi.Message) {
+			start := time.Now()
+
+			next(ctx, message)
+
+			log.Printf("Command /%s in chat %d handled in %s", cmd.Name, message.Chat.ID, time.Since(start))
+		}
+	}
+}
+
+// Timeout limits handling of the command by its own timeout or by the default one.
+func Timeout(defaultTimeout time.Duration) Middleware {
+	return func(cmd *Command, next HandlerFunc) HandlerFunc {
+		timeout := defaultTimeout
+		if cmd.Timeout > 0 {
+			timeout = cmd.Timeout
+		}
+
+		return func(ctx context.Context, message *tgbotapi.Message) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			next(ctx, message)
+		}
+	}
+}
+
+// Recovery stops panic of the handler from crashing the bot and tells user something went wrong.
+func Recovery(reply ReplyFunc) Middleware {
+	return func(cmd *Command, next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message *tgbotapi.Message) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Panic handling /%s in chat %d: %v\n%s", cmd.Name, message.Chat.ID, r, debug.Stack())
+					reply(ctx, message.Chat.ID, "Something went wrong :d")
+				}
+			}()
+
+			next(ctx, message)
+		}
+	}
+}
+
+// Cooldown rejects commands sent to the chat until the cooldown after its previous command is over,
+// the cooldown is shared by every command of the chat, commands marked NoCooldown are not affected.
+func Cooldown(cooldown time.Duration, reply ReplyFunc) Middleware {
+	lastUsage := cache.New(cooldown, 5*time.Minute)
+
+	return func(cmd *Command, next HandlerFunc) HandlerFunc {
+		if cooldown <= 0 || cmd.NoCooldown {
+			return next
+		}
+
+		return func(ctx context.Context, message *tgbotapi.Message) {
+			key := fmt.Sprint(message.Chat.ID)
+
+			if lastTime, ok := lastUsage.Get(key); ok {
+				waitTime := cooldown - time.Since(lastTime.(time.Time))
+				if waitTime > 0 {
+					reply(ctx, message.Chat.ID, fmt.Sprintf("Command on cooldown for %.1f sec", waitTime.Seconds()))
+
+					return
+				}
+			}
+
+			lastUsage.Set(key, time.Now(), cooldown)
+
+			next(ctx, message)
+		}
+	}
+}
+
+// Auth rejects admin commands from chats and users not listed in adminIDs
+// and commands not allowed in groups sent from group chats.
+func Auth(adminIDs []int64, reply ReplyFunc) Middleware {
+	return func(cmd *Command, next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message *tgbotapi.Message) {
+			if cmd.AdminOnly && !IsAdmin(adminIDs, message) {
+				reply(ctx, message.Chat.ID, "Unknown command")
+
+				return
+			}
+
+			if !cmd.GroupAllowed && !message.Chat.IsPrivate() {
+				reply(ctx, message.Chat.ID, fmt.Sprintf("Command /%s works only in private chat with the bot!", cmd.Name))
+
+				return
+			}
+
+			next(ctx, message)
+		}
+	}
+}
+
+// IsAdmin reports whether the message came from an admin user or was sent to an admin chat.
+func IsAdmin(adminIDs []int64, message *tgbotapi.Message) bool {
+	if slices.Contains(adminIDs, message.Chat.ID) {
+		return true
+	}
+
+	return message.From != nil && slices.Contains(adminIDs, message.From.ID)
+}
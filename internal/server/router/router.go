@@ -0,0 +1,130 @@
+package router
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"slices"
+	"time"
+)
+
+type (
+	HandlerFunc func(ctx context.Context, message *tgbotapi.Message)
+
+	// Middleware wraps handler of the command, it is applied to every registered command.
+	Middleware func(cmd *Command, next HandlerFunc) HandlerFunc
+
+	Command struct {
+		Name         string
+		Args         string // argument spec shown in help, like "[name] <categories>"
+		Description  string
+		Descriptions map[string]string // localized descriptions by IETF language code, like "ru"
+		Handler      HandlerFunc
+
+		Timeout      time.Duration // overrides default timeout of the router when positive, for commands uploading files
+		AdminOnly    bool          // available only to chats and users listed in admin_ids
+		GroupAllowed bool          // can be used in group chats, not only in private ones
+		Hidden       bool          // not listed in help and telegram menu
+		NoCooldown   bool          // neither limited by the cooldown nor starting it, for commands like /cancel
+	}
+
+	Router struct {
+		commands    []*Command
+		byName      map[string]*Command
+		middlewares []Middleware
+		notFound    HandlerFunc
+	}
+)
+
+func New(notFound HandlerFunc) *Router {
+	return &Router{
+		byName:   make(map[string]*Command),
+		notFound: notFound,
+	}
+}
+
+// Use appends middlewares, the first one added is the outermost.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Register adds the command, registration order is kept in help and telegram menu.
+func (r *Router) Register(cmd *Command) {
+	if _, ok := r.byName[cmd.Name]; ok {
+		log.Fatalf("Command /%s is registered twice", cmd.Name)
+	}
+
+	r.commands = append(r.commands, cmd)
+	r.byName[cmd.Name] = cmd
+}
+
+// Dispatch runs handler of the command in the message through the middleware chain,
+// unknown commands go through the same chain to the notFound handler.
+func (r *Router) Dispatch(ctx context.Context, message *tgbotapi.Message) {
+	cmd, ok := r.byName[message.Command()]
+	if !ok {
+		cmd = &Command{
+			Name:         message.Command(),
+			Handler:      r.notFound,
+			GroupAllowed: true,
+			Hidden:       true,
+		}
+	}
+
+	h := cmd.Handler
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		h = r.middlewares[i](cmd, h)
+	}
+
+	h(ctx, message)
+}
+
+// Commands returns registered commands visible to users in registration order.
+func (r *Router) Commands(admin bool, group bool) []*Command {
+	var commands []*Command
+
+	for _, cmd := range r.commands {
+		if cmd.Hidden || (cmd.AdminOnly && !admin) || (group && !cmd.GroupAllowed) {
+			continue
+		}
+
+		commands = append(commands, cmd)
+	}
+
+	return commands
+}
+
+// Languages returns sorted codes of languages commands are localized to.
+func (r *Router) Languages() []string {
+	var languages []string
+
+	for _, cmd := range r.commands {
+		for lang := range cmd.Descriptions {
+			if !slices.Contains(languages, lang) {
+				languages = append(languages, lang)
+			}
+		}
+	}
+
+	slices.Sort(languages)
+
+	return languages
+}
+
+// DescriptionFor returns description of the command in the language, default one is used if there is no translation.
+func (c *Command) DescriptionFor(lang string) string {
+	if d, ok := c.Descriptions[lang]; ok {
+		return d
+	}
+
+	return c.Description
+}
+
+// Usage returns the command with its arguments, like "/sub_filter [name] <categories>".
+func (c *Command) Usage() string {
+	if c.Args == "" {
+		return "/" + c.Name
+	}
+
+	return "/" + c.Name + " " + c.Args
+}
@@ -3,27 +3,41 @@ package server
 import (
 	"apubot/internal/config"
 	"apubot/internal/handler"
+	imageH "apubot/internal/handler/image"
+	"apubot/internal/server/router"
 	"context"
-	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/patrickmn/go-cache"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"github.com/pkg/errors"
+	"log"
+	"runtime/debug"
+	"strings"
 )
 
 const (
-	StartCommand            = "start"
-	PeepoCommand            = "peepo"
-	SubscribeCommand        = "sub"
-	UnsubscribeCommand      = "unsub"
-	SubscriptionInfoCommand = "sub_info"
-	HelpCommand             = "help"
+	StartCommand              = "start"
+	PeepoCommand              = "peepo"
+	CategoriesCommand         = "categories"
+	SubscribeCommand          = "sub"
+	UnsubscribeCommand        = "unsub"
+	SubscriptionFilterCommand = "sub_filter"
+	SubscriptionInfoCommand   = "sub_info"
+	PauseCommand              = "pause"
+	ResumeCommand             = "resume"
+	TimezoneCommand           = "timezone"
+	QuietHoursCommand         = "quiet"
+	CancelCommand             = "cancel"
+	WarmCommand               = "warm"
+	HelpCommand               = "help"
 )
 
 type botApi interface {
-	GetUpdatesChan() tgbotapi.UpdatesChannel
+	GetUpdatesChan() (tgbotapi.UpdatesChannel, error)
+	SetCommands(
+		ctx context.Context,
+		scope tgbotapi.BotCommandScope,
+		languageCode string,
+		commands []tgbotapi.BotCommand,
+	) error
 	Shutdown()
 }
 
@@ -35,104 +49,165 @@ type (
 	}
 
 	Server struct {
-		cfg       *config.Config
-		api       botApi
-		handlers  *handler.Handlers
-		lastUsage *cache.Cache
-		lastCmd   *cache.Cache
+		cfg      *config.Config
+		api      botApi
+		handlers *handler.Handlers
+		router   *router.Router
+		workers  *workerPool
+
+		// handlersCtx is the parent of update contexts, it is cancelled when handlers do not stop in time
+		handlersCtx    context.Context
+		cancelHandlers context.CancelFunc
 	}
 )
 
 func New(p *InitParams) *Server {
-	return &Server{
-		cfg:       p.Config,
-		api:       p.Api,
-		handlers:  p.Handlers,
-		lastUsage: cache.New(p.Config.CommandCooldown, 5*time.Minute),
-		lastCmd:   cache.New(time.Minute, 5*time.Minute),
+	s := &Server{
+		cfg:      p.Config,
+		api:      p.Api,
+		handlers: p.Handlers,
 	}
+
+	s.handlersCtx, s.cancelHandlers = context.WithCancel(context.Background())
+
+	reply := s.handlers.General.MessageResponse
+
+	s.router = router.New(s.unknownCommand)
+	s.router.Use(
+		router.Timeout(p.Config.RequestTimeout),
+		router.Recovery(reply),
+		router.Logging(),
+		router.Auth(p.Config.AdminIDs, reply),
+		router.Cooldown(p.Config.CommandCooldown, reply),
+	)
+	s.registerCommands()
+	s.workers = newWorkerPool(p.Config.UpdateWorkers, s.handleUpdateSafely)
+
+	return s
 }
 
-func (s *Server) Start() {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+// Start handles updates until ctx is done, then stops receiving them.
+// Updates already received are queued, Stop waits until they are handled.
+func (s *Server) Start(ctx context.Context) error {
+	s.setBotCommands(ctx)
 
-	updatesChan := s.api.GetUpdatesChan()
+	updatesChan, err := s.api.GetUpdatesChan()
+	if err != nil {
+		return errors.Wrap(err, "can not start receiving updates")
+	}
 
 	for {
 		select {
-		case update := <-updatesChan:
-			go s.handleUpdate(&update)
-		case <-c:
+		case update, ok := <-updatesChan:
+			if !ok {
+				return errors.New("updates channel closed unexpectedly")
+			}
+
+			s.submit(&update)
+		case <-ctx.Done():
 			s.api.Shutdown()
 
-			return
+			// polling has already confirmed buffered updates to telegram, they would be lost
+			for len(updatesChan) > 0 {
+				update := <-updatesChan
+				s.submit(&update)
+			}
+
+			return nil
 		}
 	}
 }
 
-func (s *Server) handleUpdate(update *tgbotapi.Update) {
-	if update.Message == nil {
-		return
+// submit queues the update for handling, it is dropped when the worker of its chat is overloaded,
+// so a single flooding chat can not stop intake of updates from other chats.
+func (s *Server) submit(update *tgbotapi.Update) {
+	if !s.workers.Submit(update) {
+		log.Printf("Dropping update %d of chat %d, its worker is overloaded", update.UpdateID, updateChatID(update))
 	}
+}
+
+// Stop waits for handlers of received updates, Start must have returned.
+// Handlers still running when ctx is done are cancelled.
+func (s *Server) Stop(ctx context.Context) error {
+	defer s.cancelHandlers()
+
+	return s.workers.Stop(ctx)
+}
+
+// handleUpdateSafely stops panic of any handler from crashing the bot and tells user something went wrong.
+func (s *Server) handleUpdateSafely(update *tgbotapi.Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic handling update %d: %v\n%s", update.UpdateID, r, debug.Stack())
+
+			if chatID := updateChatID(update); chatID != 0 {
+				ctx, cancel := context.WithTimeout(s.handlersCtx, s.cfg.RequestTimeout)
+				defer cancel()
+
+				s.handlers.General.MessageResponse(ctx, chatID, "Something went wrong :d")
+			}
+		}
+	}()
+
+	s.handleUpdate(s.handlersCtx, update)
+}
 
-	if !update.Message.IsCommand() {
-		s.handleMessage(update.Message)
+// handleUpdate routes the update to its handler, handling is limited by the request timeout.
+// Commands get timeouts from the router, as some of them upload files.
+func (s *Server) handleUpdate(ctx context.Context, update *tgbotapi.Update) {
+	if update.Message != nil && update.Message.IsCommand() {
+		s.handleCommand(ctx, update.Message)
 
 		return
 	}
 
-	s.handleCommand(update.Message)
-}
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.RequestTimeout)
+	defer cancel()
 
-func (s *Server) handleMessage(message *tgbotapi.Message) {
-	var err error
+	if update.MyChatMember != nil {
+		s.handlers.Chat.MemberUpdated(ctx, update.MyChatMember)
 
-	lastUsedCmd, _ := s.lastCmd.Get(fmt.Sprint(message.Chat.ID))
+		return
+	}
 
-	switch lastUsedCmd {
-	case SubscribeCommand:
-		err = s.handlers.Image.CreateSubscription(context.Background(), message)
-	default:
-		msgText := "I can only handle listed commands in this chat!"
-		s.handlers.General.MessageResponse(message.Chat.ID, msgText)
+	if update.CallbackQuery != nil {
+		s.handleCallback(ctx, update.CallbackQuery)
+
+		return
 	}
 
-	if err != nil {
+	if update.Message == nil {
 		return
 	}
 
-	s.lastCmd.Delete(fmt.Sprint(message.Chat.ID))
+	s.handleMessage(ctx, update.Message)
 }
 
-func (s *Server) handleCommand(message *tgbotapi.Message) {
-	if lastTime, ok := s.lastUsage.Get(fmt.Sprint(message.Chat.ID)); ok {
-		waitTime := s.cfg.CommandCooldown - time.Since(lastTime.(time.Time))
-		if waitTime > 0 {
-			msgText := fmt.Sprintf("Command on cooldown for %.1f sec", waitTime.Seconds())
-			s.handlers.General.MessageResponse(message.Chat.ID, msgText)
-
-			return
-		}
+func (s *Server) handleMessage(ctx context.Context, message *tgbotapi.Message) {
+	if s.handlers.Dialog.HandleMessage(ctx, message) {
+		return
 	}
 
-	switch message.Command() {
-	case StartCommand:
-		s.handlers.General.StartResponse(message.Chat.ID)
-	case PeepoCommand:
-		s.handlers.Image.GetImage(context.Background(), message)
-	case SubscribeCommand:
-		_ = s.handlers.Image.CreateSubscription(context.Background(), message)
-	case UnsubscribeCommand:
-		s.handlers.Image.DeleteSubscription(context.Background(), message)
-	case SubscriptionInfoCommand:
-		s.handlers.Image.GetSubscription(context.Background(), message)
-	case HelpCommand:
-		s.handlers.General.HelpResponse(message.Chat.ID)
+	msgText := "I can only handle listed commands in this chat!"
+	s.handlers.General.MessageResponse(ctx, message.Chat.ID, msgText)
+}
+
+// handleCallback routes inline keyboard buttons, callback data is prefixed with the handler which sent the keyboard.
+func (s *Server) handleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	prefix, _, _ := strings.Cut(query.Data, ":")
+
+	switch prefix {
+	case imageH.SubscribeCallback:
+		s.handlers.Image.CreateSubscriptionCallback(ctx, query)
+	case imageH.UnsubscribeCallback:
+		s.handlers.Image.DeleteSubscriptionCallback(ctx, query)
+	case imageH.ResumeCallback:
+		s.handlers.Image.ResumeSubscriptionCallback(ctx, query)
 	default:
-		s.handlers.General.MessageResponse(message.Chat.ID, "Unknown command")
+		log.Printf("Unknown callback data: %q", query.Data)
 	}
+}
 
-	s.lastUsage.Set(fmt.Sprint(message.Chat.ID), time.Now(), cache.DefaultExpiration)
-	s.lastCmd.Set(fmt.Sprint(message.Chat.ID), message.Command(), cache.DefaultExpiration)
+func (s *Server) handleCommand(ctx context.Context, message *tgbotapi.Message) {
+	s.router.Dispatch(ctx, message)
 }
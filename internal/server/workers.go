@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// updateQueueSize is the number of updates each worker buffers, updates beyond it are dropped.
+const updateQueueSize = 64
+
+// workerPool handles updates with a fixed number of goroutines,
+// updates of one chat always go to the same worker, so they are handled in order.
+type workerPool struct {
+	queues []chan *tgbotapi.Update
+	handle func(update *tgbotapi.Update)
+	wg     sync.WaitGroup
+}
+
+func newWorkerPool(workers int, handle func(update *tgbotapi.Update)) *workerPool {
+	p := &workerPool{
+		queues: make([]chan *tgbotapi.Update, workers),
+		handle: handle,
+	}
+
+	for i := range p.queues {
+		p.queues[i] = make(chan *tgbotapi.Update, updateQueueSize)
+
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+
+	return p
+}
+
+func (p *workerPool) work(queue chan *tgbotapi.Update) {
+	defer p.wg.Done()
+
+	for update := range queue {
+		p.handle(update)
+	}
+}
+
+// Submit queues the update to the worker of its chat without blocking,
+// false is returned when that worker is overloaded, the update is dropped then.
+// One flooding chat fills only the queue of its worker, other workers keep taking updates.
+func (p *workerPool) Submit(update *tgbotapi.Update) bool {
+	queue := p.queues[uint64(updateChatID(update))%uint64(len(p.queues))]
+
+	select {
+	case queue <- update:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop waits until every queued update is handled, Submit must not be called after it.
+func (p *workerPool) Stop(ctx context.Context) error {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "updates are still being handled")
+	}
+}
+
+// updateChatID returns id of the chat the update belongs to, updates without chat use sender id.
+func updateChatID(update *tgbotapi.Update) int64 {
+	// FromChat panics on callbacks of inline messages, they have no message
+	if update.CallbackQuery != nil && update.CallbackQuery.Message == nil {
+		return update.CallbackQuery.From.ID
+	}
+
+	switch {
+	case update.MyChatMember != nil:
+		return update.MyChatMember.Chat.ID
+	case update.FromChat() != nil:
+		return update.FromChat().ID
+	case update.SentFrom() != nil:
+		return update.SentFrom().ID
+	default:
+		return 0
+	}
+}
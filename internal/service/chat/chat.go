@@ -0,0 +1,94 @@
+package chat
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/utils/clock"
+	"context"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type Service struct {
+	cfg   *config.Config
+	clock clock.Clock
+	repo  ChatRepository
+}
+
+func New(cfg *config.Config, clk clock.Clock, repo ChatRepository) *Service {
+	return &Service{
+		cfg:   cfg,
+		clock: clk,
+		repo:  repo,
+	}
+}
+
+// UpdateStatus saves bot membership status in the chat and returns the previously known state.
+// Status of the previous state is empty if the chat was never seen before.
+func (s *Service) UpdateStatus(ctx context.Context, chatId int64, status string) (prev domain.Chat, err error) {
+	prev, err = s.repo.Get(ctx, chatId)
+
+	var notFoundErr *custom_errors.NotFoundError
+	if err != nil && !errors.As(err, &notFoundErr) {
+		return prev, errors.Wrap(err, "can not get chat")
+	}
+
+	chat := domain.Chat{
+		ChatId:    chatId,
+		Status:    status,
+		UpdatedAt: s.clock.Now().Unix(),
+	}
+
+	err = s.repo.Save(ctx, chat)
+	if err != nil {
+		return prev, errors.Wrap(err, "can not save chat")
+	}
+
+	return prev, nil
+}
+
+// Get returns the chat with its settings, chats never seen before get default settings.
+func (s *Service) Get(ctx context.Context, chatId int64) (chat domain.Chat, err error) {
+	chat, err = s.repo.Get(ctx, chatId)
+
+	var notFoundErr *custom_errors.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return domain.Chat{ChatId: chatId, Status: domain.ChatStatusMember}, nil
+	}
+
+	if err != nil {
+		return chat, errors.Wrap(err, "can not get chat")
+	}
+
+	return chat, nil
+}
+
+// SetTimezone changes time zone of the chat, timezone must be an IANA name like Europe/Berlin.
+func (s *Service) SetTimezone(ctx context.Context, chatId int64, timezone string) error {
+	_, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "" || timezone == "Local" {
+		return custom_errors.NewNotFound("unknown time zone")
+	}
+
+	err = s.repo.SetTimezone(ctx, chatId, timezone)
+	if err != nil {
+		return errors.Wrap(err, "can not save time zone")
+	}
+
+	return nil
+}
+
+// SetQuietHours changes quiet hours of the chat, disabled window turns them off.
+func (s *Service) SetQuietHours(ctx context.Context, chatId int64, quiet domain.QuietHours) error {
+	if !quiet.IsEnabled() {
+		quiet = domain.QuietHours{Policy: domain.QuietPolicyDefer}
+	}
+
+	err := s.repo.SetQuietHours(ctx, chatId, quiet)
+	if err != nil {
+		return errors.Wrap(err, "can not save quiet hours")
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package chat
+
+import (
+	"apubot/internal/domain"
+	"context"
+)
+
+type ChatService interface {
+	UpdateStatus(ctx context.Context, chatId int64, status string) (prev domain.Chat, err error)
+	Get(ctx context.Context, chatId int64) (chat domain.Chat, err error)
+	SetTimezone(ctx context.Context, chatId int64, timezone string) error
+	SetQuietHours(ctx context.Context, chatId int64, quiet domain.QuietHours) error
+}
+
+type ChatRepository interface {
+	Get(ctx context.Context, chatId int64) (chat domain.Chat, err error)
+	Save(ctx context.Context, chat domain.Chat) error
+	SetTimezone(ctx context.Context, chatId int64, timezone string) error
+	SetQuietHours(ctx context.Context, chatId int64, quiet domain.QuietHours) error
+}
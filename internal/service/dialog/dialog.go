@@ -0,0 +1,121 @@
+package dialog
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/utils/clock"
+	"context"
+	"github.com/pkg/errors"
+	"log"
+)
+
+type Service struct {
+	cfg     *config.Config
+	clock   clock.Clock
+	repo    DialogRepository
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func New(cfg *config.Config, clk clock.Clock, repo DialogRepository) *Service {
+	service := &Service{
+		cfg:     cfg,
+		clock:   clk,
+		repo:    repo,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go service.dropExpired()
+
+	return service
+}
+
+// Stop ends removal of abandoned dialogs and waits until the running one is done.
+func (s *Service) Stop(ctx context.Context) error {
+	close(s.done)
+
+	select {
+	case <-s.stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "expired dialogs are still being deleted")
+	}
+}
+
+// dropExpired periodically removes abandoned dialogs, expired ones are never returned anyway.
+func (s *Service) dropExpired() {
+	defer close(s.stopped)
+
+	ticker := s.clock.NewTicker(s.cfg.Dialog.Timeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+		case <-s.done:
+			return
+		}
+
+		err := s.repo.DeleteExpired(context.Background(), s.clock.Now().Unix())
+		if err != nil {
+			log.Printf("Error deleting expired dialogs: %v", err)
+		}
+	}
+}
+
+// Start begins a dialog in the given state, previous dialog of the chat is dropped.
+func (s *Service) Start(ctx context.Context, chatId int64, state string, data map[string]string) error {
+	session := domain.DialogSession{
+		ChatId: chatId,
+		State:  state,
+		Data:   data,
+	}
+
+	return s.Continue(ctx, session)
+}
+
+// Get returns the active dialog of the chat, NotFoundError is returned when there is none or it has expired.
+func (s *Service) Get(ctx context.Context, chatId int64) (session domain.DialogSession, err error) {
+	session, err = s.repo.Get(ctx, chatId)
+	if err != nil {
+		return session, errors.Wrap(err, "can not get dialog")
+	}
+
+	if session.ExpiresAt <= s.clock.Now().Unix() {
+		err = s.repo.Delete(ctx, chatId)
+		if err != nil {
+			log.Printf("Error deleting expired dialog %d: %v", chatId, err)
+		}
+
+		return domain.DialogSession{}, custom_errors.NewNotFound("dialog expired")
+	}
+
+	if session.Data == nil {
+		session.Data = make(map[string]string)
+	}
+
+	return session, nil
+}
+
+// Continue saves the dialog moved to its next state and prolongs its timeout.
+func (s *Service) Continue(ctx context.Context, session domain.DialogSession) error {
+	session.ExpiresAt = s.clock.Now().Add(s.cfg.Dialog.Timeout).Unix()
+
+	err := s.repo.Save(ctx, session)
+	if err != nil {
+		return errors.Wrap(err, "can not save dialog")
+	}
+
+	return nil
+}
+
+func (s *Service) Finish(ctx context.Context, chatId int64) error {
+	err := s.repo.Delete(ctx, chatId)
+	if err != nil {
+		return errors.Wrap(err, "can not delete dialog")
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package dialog
+
+import (
+	"apubot/internal/domain"
+	"context"
+)
+
+type DialogService interface {
+	Start(ctx context.Context, chatId int64, state string, data map[string]string) error
+	Get(ctx context.Context, chatId int64) (session domain.DialogSession, err error)
+	Continue(ctx context.Context, session domain.DialogSession) error
+	Finish(ctx context.Context, chatId int64) error
+}
+
+type DialogRepository interface {
+	Get(ctx context.Context, chatId int64) (session domain.DialogSession, err error)
+	Save(ctx context.Context, session domain.DialogSession) error
+	Delete(ctx context.Context, chatId int64) error
+	DeleteExpired(ctx context.Context, now int64) error
+}
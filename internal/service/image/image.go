@@ -3,28 +3,55 @@ package image
 import (
 	"apubot/internal/config"
 	"apubot/internal/domain"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/utils/clock"
+	"apubot/pkg/utils/random"
 	"context"
 	"github.com/pkg/errors"
 	"log"
-	"math/rand"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
 )
 
+// maxRandomProbes is the number of random picks tried before falling back to a full scan.
+const maxRandomProbes = 8
+
+var supportedExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".mp4", ".webm"}
+
 type Service struct {
 	cfg            *config.Config
+	clock          clock.Clock
+	rand           *random.Rand
 	repo           ImageRepository
-	availableFiles map[string]string
+	historyRepo    HistoryRepository
+	availableFiles []domain.File
+	fileIndex      map[string]int   // file name -> position in availableFiles
+	categoryIndex  map[string][]int // category -> positions in availableFiles
 	mu             sync.RWMutex
+	done           chan struct{} // closed to stop watching images directory
+	watcher        sync.WaitGroup
 }
 
-func New(cfg *config.Config, repo ImageRepository) *Service {
+func New(
+	cfg *config.Config,
+	clk clock.Clock,
+	rnd *random.Rand,
+	repo ImageRepository,
+	historyRepo HistoryRepository,
+) *Service {
 	service := &Service{
-		cfg:            cfg,
-		repo:           repo,
-		availableFiles: make(map[string]string),
+		cfg:           cfg,
+		clock:         clk,
+		rand:          rnd,
+		repo:          repo,
+		historyRepo:   historyRepo,
+		fileIndex:     make(map[string]int),
+		categoryIndex: make(map[string][]int),
+		done:          make(chan struct{}),
 	}
 
 	err := service.updateAvailableFiles()
@@ -32,76 +59,339 @@ func New(cfg *config.Config, repo ImageRepository) *Service {
 		log.Fatalf("can not initialize Image service: %v", err)
 	}
 
+	service.watchImagesDir()
+
 	return service
 }
 
-func (s *Service) updateAvailableFiles() error {
-	var imageFiles map[string]string
-	supportedExtensions := []string{".jpg", ".jpeg", ".png", ".gif"}
+// scanImagesDir lists supported files in the images directory,
+// files of each subdirectory belong to the category named after it.
+func (s *Service) scanImagesDir() (map[string]domain.File, error) {
+	entries, err := os.ReadDir(s.cfg.ImagesDirPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not read directory")
+	}
+
+	files := make(map[string]domain.File, len(entries))
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		if !entry.IsDir() {
+			if isSupported(entry.Name()) {
+				files[entry.Name()] = domain.File{Name: entry.Name()}
+			}
+
+			continue
+		}
+
+		subEntries, err := os.ReadDir(filepath.Join(s.cfg.ImagesDirPath, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrap(err, "can not read category directory")
+		}
 
-	imageFiles, err := s.repo.GetAll(context.Background())
+		category := strings.ToLower(entry.Name())
+
+		for _, subEntry := range subEntries {
+			if subEntry.IsDir() || !isSupported(subEntry.Name()) {
+				continue
+			}
+
+			name := path.Join(entry.Name(), subEntry.Name())
+			files[name] = domain.File{Name: name, Category: category}
+		}
+	}
+
+	return files, nil
+}
+
+func isSupported(fileName string) bool {
+	return slices.Contains(supportedExtensions, filepath.Ext(fileName))
+}
+
+// updateAvailableFiles rescans images directory and atomically replaces the set of available files.
+// Newly found files are saved to db and rows of files which no longer exist on disk are removed.
+func (s *Service) updateAvailableFiles() error {
+	dbFiles, err := s.repo.GetAll(context.Background())
 	if err != nil {
 		return errors.Wrap(err, "can not read data from db")
 	}
 
-	filesFs, err := os.ReadDir(s.cfg.ImagesDirPath)
+	imageFiles, err := s.scanImagesDir()
 	if err != nil {
-		return errors.Wrap(err, "can not read directory")
+		return err
 	}
 
-	for _, fileFs := range filesFs {
-		if fileFs.IsDir() {
-			continue
+	// keep current files if directory is empty, it is most likely not mounted
+	if len(imageFiles) == 0 {
+		return errors.New("no available images in selected directory")
+	}
+
+	var newFiles []domain.File
+	for name, file := range imageFiles {
+		dbFile, ok := dbFiles[name]
+		if !ok || dbFile.Category != file.Category {
+			newFiles = append(newFiles, file)
 		}
 
-		ext := filepath.Ext(fileFs.Name())
-		if !slices.Contains(supportedExtensions, ext) {
-			continue
+		file.TgID = dbFile.TgID
+		imageFiles[name] = file
+	}
+
+	if len(newFiles) > 0 {
+		err = s.repo.AddImages(context.Background(), newFiles)
+		if err != nil {
+			return errors.Wrap(err, "can not save new images")
+		}
+	}
+
+	var stale []string
+	for name := range dbFiles {
+		if _, ok := imageFiles[name]; !ok {
+			stale = append(stale, name)
+		}
+	}
+
+	if len(stale) > 0 {
+		err = s.repo.DeleteImages(context.Background(), stale)
+		if err != nil {
+			return errors.Wrap(err, "can not delete stale images")
 		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		_, ok := imageFiles[fileFs.Name()]
+	var added, removed []string
+	for name, file := range imageFiles {
+		idx, ok := s.fileIndex[name]
 		if !ok {
-			imageFiles[fileFs.Name()] = ""
+			added = append(added, name)
+
+			continue
+		}
+
+		// telegram id could be saved after db was read
+		if file.TgID == "" {
+			file.TgID = s.availableFiles[idx].TgID
+			imageFiles[name] = file
 		}
 	}
 
-	if len(imageFiles) == 0 {
-		return errors.New("no available images in selected directory or db")
+	for _, file := range s.availableFiles {
+		if _, ok := imageFiles[file.Name]; !ok {
+			removed = append(removed, file.Name)
+		}
+	}
+
+	initial := len(s.availableFiles) == 0
+
+	s.availableFiles = make([]domain.File, 0, len(imageFiles))
+	s.fileIndex = make(map[string]int, len(imageFiles))
+	s.categoryIndex = make(map[string][]int)
+
+	for _, file := range imageFiles {
+		s.addFileLocked(file)
 	}
 
-	s.availableFiles = imageFiles
+	if initial {
+		log.Printf("Loaded %d image(s) in %d categories", len(s.availableFiles), len(s.categoryIndex))
+
+		return nil
+	}
+
+	if len(added) > 0 {
+		slices.Sort(added)
+		log.Printf("Images added (%d): %s", len(added), strings.Join(added, ", "))
+	}
+
+	if len(removed) > 0 {
+		slices.Sort(removed)
+		log.Printf("Images removed (%d): %s", len(removed), strings.Join(removed, ", "))
+	}
 
 	return nil
 }
 
-func (s *Service) GetRandomFile(ctx context.Context) (domain.File, error) {
+// addFileLocked appends the file to available ones, must be called with mu held.
+func (s *Service) addFileLocked(file domain.File) {
+	idx := len(s.availableFiles)
+
+	s.availableFiles = append(s.availableFiles, file)
+	s.fileIndex[file.Name] = idx
+	s.categoryIndex[file.Category] = append(s.categoryIndex[file.Category], idx)
+}
+
+// SelectFile picks a random file matching the filter which is not in recentlySent,
+// names there are ordered from most to least recently sent.
+// When every matching file was sent recently, the least recently sent one is returned.
+func (s *Service) SelectFile(
+	ctx context.Context,
+	filter domain.CategoryFilter,
+	recentlySent []string,
+) (domain.File, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	n := rand.Intn(len(s.availableFiles))
+	if len(s.availableFiles) == 0 {
+		return domain.File{}, errors.New("no available files")
+	}
+
+	pool, err := s.poolLocked(filter)
+	if err != nil {
+		return domain.File{}, err
+	}
+
+	size := len(s.availableFiles)
+	if pool != nil {
+		size = len(pool)
+	}
+
+	fileAt := func(i int) domain.File {
+		if pool == nil {
+			return s.availableFiles[i]
+		}
 
-	for k, v := range s.availableFiles {
-		if n == 0 {
-			return domain.File{Name: k, TgID: v}, nil
+		return s.availableFiles[pool[i]]
+	}
+
+	excluded := make(map[string]struct{}, len(recentlySent))
+	for _, name := range recentlySent {
+		excluded[name] = struct{}{}
+	}
+
+	// most of the time the collection is much bigger than the history, so random probing is enough
+	for i := 0; i < maxRandomProbes; i++ {
+		file := fileAt(s.rand.Intn(size))
+
+		if _, ok := excluded[file.Name]; !ok {
+			return file, nil
 		}
+	}
 
-		n--
+	candidates := make([]int, 0, size)
+	for i := 0; i < size; i++ {
+		if _, ok := excluded[fileAt(i).Name]; !ok {
+			candidates = append(candidates, i)
+		}
+	}
+
+	if len(candidates) > 0 {
+		return fileAt(candidates[s.rand.Intn(len(candidates))]), nil
+	}
+
+	// every matching file was sent recently
+	for i := len(recentlySent) - 1; i >= 0; i-- {
+		idx, ok := s.fileIndex[recentlySent[i]]
+		if ok && filter.Matches(s.availableFiles[idx].Category) {
+			return s.availableFiles[idx], nil
+		}
 	}
 
 	// this should never happen
-	return domain.File{}, errors.New("GetRandomFile: no file selected")
+	return domain.File{}, errors.New("SelectFile: no file selected")
+}
+
+// poolLocked returns positions of files matching the filter, nil means every file.
+// Must be called with mu held.
+func (s *Service) poolLocked(filter domain.CategoryFilter) ([]int, error) {
+	if filter.IsEmpty() {
+		return nil, nil
+	}
+
+	var pool []int
+
+	if len(filter.Include) == 1 && len(filter.Exclude) == 0 {
+		pool = s.categoryIndex[filter.Include[0]]
+	} else {
+		for category, positions := range s.categoryIndex {
+			if filter.Matches(category) {
+				pool = append(pool, positions...)
+			}
+		}
+	}
+
+	if len(pool) == 0 {
+		return nil, custom_errors.NewNotFound("no images match the filter")
+	}
+
+	return pool, nil
+}
+
+// GetCategories returns number of available files per category, files without category are not counted.
+func (s *Service) GetCategories(ctx context.Context) map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	categories := make(map[string]int, len(s.categoryIndex))
+	for category, positions := range s.categoryIndex {
+		if category == "" {
+			continue
+		}
+
+		categories[category] = len(positions)
+	}
+
+	return categories
 }
 
+// UpdateFile saves telegram id of the sent file.
+// Files removed from the images directory while being sent are skipped, so they do not come back.
 func (s *Service) UpdateFile(ctx context.Context, file domain.File) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	err := s.repo.SaveImage(ctx, file)
+	idx, ok := s.fileIndex[file.Name]
+	if !ok {
+		return nil
+	}
+
+	err := s.repo.UpdateTgID(ctx, file.Name, file.TgID)
 	if err != nil {
 		return errors.Wrap(err, "can not update image")
 	}
 
-	s.availableFiles[file.Name] = file.TgID
+	s.availableFiles[idx].TgID = file.TgID
+
+	return nil
+}
+
+// GetNotUploaded returns files without telegram id sorted by name.
+func (s *Service) GetNotUploaded(ctx context.Context) []domain.File {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var files []domain.File
+	for _, file := range s.availableFiles {
+		if file.TgID == "" {
+			files = append(files, file)
+		}
+	}
+
+	slices.SortFunc(files, func(a, b domain.File) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return files
+}
+
+// GetRecentlySent returns names of images recently sent to the chat, most recent first.
+func (s *Service) GetRecentlySent(ctx context.Context, chatId int64) ([]string, error) {
+	names, err := s.historyRepo.GetRecent(ctx, chatId, s.cfg.LastSentQueueSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get sent history")
+	}
+
+	return names, nil
+}
+
+func (s *Service) MarkSent(ctx context.Context, chatId int64, name string) error {
+	err := s.historyRepo.Add(ctx, chatId, name, s.clock.Now().Unix(), s.cfg.LastSentQueueSize)
+	if err != nil {
+		return errors.Wrap(err, "can not save sent history")
+	}
 
 	return nil
 }
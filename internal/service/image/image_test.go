@@ -0,0 +1,198 @@
+package image
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/utils/clock"
+	"apubot/pkg/utils/random"
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+const testSeed = 42
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+type sentRecord struct {
+	chatId int64
+	name   string
+	sentAt int64
+}
+
+// memoryHistory keeps sent images in order they were sent.
+type memoryHistory struct {
+	sent []sentRecord
+}
+
+func (h *memoryHistory) GetRecent(ctx context.Context, chatId int64, limit int) ([]string, error) {
+	var names []string
+
+	for i := len(h.sent) - 1; i >= 0 && len(names) < limit; i-- {
+		if h.sent[i].chatId == chatId {
+			names = append(names, h.sent[i].name)
+		}
+	}
+
+	return names, nil
+}
+
+func (h *memoryHistory) Add(ctx context.Context, chatId int64, imageName string, sentAt int64, keep int) error {
+	h.sent = append(h.sent, sentRecord{chatId: chatId, name: imageName, sentAt: sentAt})
+
+	return nil
+}
+
+// newTestService returns the service holding the files without scanning a directory.
+func newTestService(files ...domain.File) *Service {
+	s := &Service{
+		cfg:           &config.Config{LastSentQueueSize: 2},
+		clock:         clock.NewFake(testNow),
+		rand:          random.New(testSeed),
+		historyRepo:   &memoryHistory{},
+		fileIndex:     make(map[string]int),
+		categoryIndex: make(map[string][]int),
+	}
+
+	for _, file := range files {
+		s.addFileLocked(file)
+	}
+
+	return s
+}
+
+func TestSelectFileAvoidsRecentlySent(t *testing.T) {
+	s := newTestService(
+		domain.File{Name: "a.png"},
+		domain.File{Name: "b.png"},
+		domain.File{Name: "c.png"},
+		domain.File{Name: "d.png"},
+		domain.File{Name: "e.png"},
+	)
+
+	recentlySent := []string{"a.png", "c.png", "e.png"}
+	picked := make(map[string]int)
+
+	for i := 0; i < 100; i++ {
+		file, err := s.SelectFile(context.Background(), domain.CategoryFilter{}, recentlySent)
+		if err != nil {
+			t.Fatalf("SelectFile: %v", err)
+		}
+
+		picked[file.Name]++
+	}
+
+	for _, name := range recentlySent {
+		if picked[name] > 0 {
+			t.Errorf("recently sent %s was selected %d times", name, picked[name])
+		}
+	}
+
+	if picked["b.png"] == 0 || picked["d.png"] == 0 {
+		t.Errorf("selection is not random, picked: %v", picked)
+	}
+}
+
+func TestSelectFileAllRecentlySent(t *testing.T) {
+	s := newTestService(
+		domain.File{Name: "cats/a.png", Category: "cats"},
+		domain.File{Name: "cats/b.png", Category: "cats"},
+		domain.File{Name: "dogs/c.png", Category: "dogs"},
+	)
+
+	tests := []struct {
+		name         string
+		filter       domain.CategoryFilter
+		recentlySent []string
+		want         string
+	}{
+		{
+			name:         "history longer than the pool",
+			recentlySent: []string{"cats/b.png", "dogs/c.png", "cats/a.png", "gone.png"},
+			want:         "cats/a.png",
+		},
+		{
+			name:         "least recently sent matching the filter",
+			filter:       domain.CategoryFilter{Include: []string{"cats"}},
+			recentlySent: []string{"cats/a.png", "cats/b.png", "dogs/c.png"},
+			want:         "cats/b.png",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := s.SelectFile(context.Background(), tt.filter, tt.recentlySent)
+			if err != nil {
+				t.Fatalf("SelectFile: %v", err)
+			}
+
+			if file.Name != tt.want {
+				t.Errorf("SelectFile = %s, want %s", file.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectFileIsReproducibleWithSeed(t *testing.T) {
+	files := []domain.File{
+		{Name: "a.png"},
+		{Name: "b.png"},
+		{Name: "c.png"},
+		{Name: "d.png"},
+		{Name: "e.png"},
+	}
+
+	picks := func() []string {
+		s := newTestService(files...)
+
+		var names []string
+
+		for i := 0; i < 20; i++ {
+			recentlySent, err := s.GetRecentlySent(context.Background(), 1)
+			if err != nil {
+				t.Fatalf("GetRecentlySent: %v", err)
+			}
+
+			file, err := s.SelectFile(context.Background(), domain.CategoryFilter{}, recentlySent)
+			if err != nil {
+				t.Fatalf("SelectFile: %v", err)
+			}
+
+			if slices.Contains(recentlySent, file.Name) {
+				t.Fatalf("pick %d: %s was sent recently: %v", i, file.Name, recentlySent)
+			}
+
+			err = s.MarkSent(context.Background(), 1, file.Name)
+			if err != nil {
+				t.Fatalf("MarkSent: %v", err)
+			}
+
+			names = append(names, file.Name)
+		}
+
+		return names
+	}
+
+	first, second := picks(), picks()
+	if !slices.Equal(first, second) {
+		t.Errorf("same seed gave different picks:\n%v\n%v", first, second)
+	}
+}
+
+func TestMarkSentUsesClock(t *testing.T) {
+	s := newTestService(domain.File{Name: "a.png"})
+	clk := s.clock.(*clock.Fake)
+	history := s.historyRepo.(*memoryHistory)
+
+	clk.Advance(time.Hour)
+
+	err := s.MarkSent(context.Background(), 1, "a.png")
+	if err != nil {
+		t.Fatalf("MarkSent: %v", err)
+	}
+
+	if want := testNow.Add(time.Hour).Unix(); history.sent[0].sentAt != want {
+		t.Errorf("sent at %d, want %d", history.sent[0].sentAt, want)
+	}
+}
@@ -6,11 +6,22 @@ import (
 )
 
 type ImageService interface {
-	GetRandomFile(ctx context.Context) (domain.File, error)
+	SelectFile(ctx context.Context, filter domain.CategoryFilter, recentlySent []string) (domain.File, error)
+	GetCategories(ctx context.Context) map[string]int
 	UpdateFile(ctx context.Context, file domain.File) error
+	GetNotUploaded(ctx context.Context) []domain.File
+	GetRecentlySent(ctx context.Context, chatId int64) ([]string, error)
+	MarkSent(ctx context.Context, chatId int64, name string) error
 }
 
 type ImageRepository interface {
-	GetAll(ctx context.Context) (map[string]string, error)
-	SaveImage(ctx context.Context, file domain.File) error
+	GetAll(ctx context.Context) (map[string]domain.File, error)
+	UpdateTgID(ctx context.Context, name string, tgID string) error
+	AddImages(ctx context.Context, files []domain.File) error
+	DeleteImages(ctx context.Context, names []string) error
+}
+
+type HistoryRepository interface {
+	GetRecent(ctx context.Context, chatId int64, limit int) ([]string, error)
+	Add(ctx context.Context, chatId int64, imageName string, sentAt int64, keep int) error
 }
@@ -0,0 +1,152 @@
+package image
+
+import (
+	"apubot/internal/config"
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// reloadDebounce delays reload until a burst of file system events is over.
+const reloadDebounce = 2 * time.Second
+
+func (s *Service) watchImagesDir() {
+	switch s.cfg.ImagesWatch.Mode {
+	case config.ImagesWatchModeRescan:
+		s.goWatch(func() { s.rescanPeriodically(s.cfg.ImagesWatch.Interval) })
+	case config.ImagesWatchModeInotify:
+		watcher, err := fsnotify.NewWatcher()
+		if err == nil {
+			err = s.addWatches(watcher)
+		}
+
+		if err != nil {
+			log.Printf("Can not watch images directory, falling back to rescan: %v", err)
+			s.goWatch(func() { s.rescanPeriodically(config.DefaultImagesRescanInterval) })
+
+			return
+		}
+
+		s.goWatch(func() { s.watchEvents(watcher) })
+	}
+}
+
+func (s *Service) goWatch(watch func()) {
+	s.watcher.Add(1)
+
+	go func() {
+		defer s.watcher.Done()
+
+		watch()
+	}()
+}
+
+// Stop ends watching images directory and waits until the running reload is done.
+func (s *Service) Stop(ctx context.Context) error {
+	close(s.done)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.watcher.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "images are still being reloaded")
+	}
+}
+
+// addWatches subscribes to changes of images directory and each category subdirectory.
+func (s *Service) addWatches(watcher *fsnotify.Watcher) error {
+	err := watcher.Add(s.cfg.ImagesDirPath)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(s.cfg.ImagesDirPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		err = watcher.Add(filepath.Join(s.cfg.ImagesDirPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) rescanPeriodically(interval time.Duration) {
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			s.reload()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Service) watchEvents(watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	debounce := s.clock.NewTimer(reloadDebounce)
+	debounce.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+
+			// new category directory
+			if event.Has(fsnotify.Create) && filepath.Dir(event.Name) == filepath.Clean(s.cfg.ImagesDirPath) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err = watcher.Add(event.Name); err != nil {
+						log.Printf("Can not watch category directory %s: %v", event.Name, err)
+					}
+				}
+			}
+
+			debounce.Reset(reloadDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			log.Printf("Images directory watcher error: %v", err)
+		case <-debounce.C():
+			s.reload()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Service) reload() {
+	err := s.updateAvailableFiles()
+	if err != nil {
+		log.Printf("Can not reload images: %v", err)
+	}
+}
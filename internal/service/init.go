@@ -3,17 +3,28 @@ package service
 import (
 	"apubot/internal/config"
 	"apubot/internal/infrastructure/repository"
+	"apubot/internal/service/chat"
+	"apubot/internal/service/dialog"
 	"apubot/internal/service/image"
 	"apubot/internal/service/subscription"
+	"apubot/pkg/utils/clock"
+	"apubot/pkg/utils/random"
+	"context"
+	stderrors "errors"
+	"github.com/pkg/errors"
 )
 
 type (
 	InitParams struct {
 		Config       *config.Config
 		Repositories *repository.Repositories
+		Clock        clock.Clock
+		Rand         *random.Rand
 	}
 
 	Services struct {
+		Chat         *chat.Service
+		Dialog       *dialog.Service
 		Image        *image.Service
 		Subscription *subscription.Service
 	}
@@ -21,7 +32,19 @@ type (
 
 func New(p *InitParams) *Services {
 	return &Services{
-		Image:        image.New(p.Config, p.Repositories.Image),
-		Subscription: subscription.New(p.Config, p.Repositories.Subscription),
+		Chat:         chat.New(p.Config, p.Clock, p.Repositories.Chat),
+		Dialog:       dialog.New(p.Config, p.Clock, p.Repositories.Dialog),
+		Image:        image.New(p.Config, p.Clock, p.Rand, p.Repositories.Image, p.Repositories.History),
+		Subscription: subscription.New(p.Config, p.Clock, p.Repositories.Subscription, p.Repositories.Chat),
 	}
 }
+
+// Stop ends background work of services, scheduled sends are stopped first as they use the others.
+// Every service is stopped even if some of them fail to stop in time.
+func (s *Services) Stop(ctx context.Context) error {
+	return stderrors.Join(
+		errors.Wrap(s.Subscription.Stop(ctx), "can not stop subscription service"),
+		errors.Wrap(s.Image.Stop(ctx), "can not stop image service"),
+		errors.Wrap(s.Dialog.Stop(ctx), "can not stop dialog service"),
+	)
+}
@@ -1,10 +1,18 @@
 package subscription
 
-import "time"
+import (
+	"apubot/internal/domain"
+	"context"
+	"time"
+)
 
-type StartWorkerInput struct {
-	ChatID   int64
-	ExitChan chan struct{}
-	Delay    time.Duration
-	Period   time.Duration
+// SendFunc delivers a scheduled image to the subscribed chat.
+// NotFoundError means there is nothing to send right now, like no images matching the filter.
+type SendFunc func(ctx context.Context, sub domain.Subscription) error
+
+// SchedulerStats describes the current load of the subscription scheduler.
+type SchedulerStats struct {
+	Scheduled  int           // number of scheduled subscriptions
+	QueueDepth int           // number of subscriptions whose send is overdue
+	Lag        time.Duration // delay of the most overdue send
 }
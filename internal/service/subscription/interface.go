@@ -2,20 +2,32 @@ package subscription
 
 import (
 	"apubot/internal/domain"
-	"apubot/pkg/utils/queue"
 	"context"
+	"time"
 )
 
 type SubscriptionService interface {
-	Get(ctx context.Context, chatId int64) (sub domain.Subscription, err error)
-	Create(ctx context.Context, sub domain.Subscription, sendFunc func(chatId int64, q *queue.Queue) error) error
-	Delete(ctx context.Context, chatId int64) error
-	RescheduleExisting(ctx context.Context, sendFunc func(chatId int64, q *queue.Queue) error) error
+	Get(ctx context.Context, chatId int64, name string) (sub domain.Subscription, err error)
+	List(ctx context.Context, chatId int64) (subs []domain.Subscription, err error)
+	Create(ctx context.Context, sub domain.Subscription, sendFunc SendFunc) error
+	Delete(ctx context.Context, chatId int64, id int64) error
+	SetFilter(ctx context.Context, sub domain.Subscription, filter domain.CategoryFilter, sendFunc SendFunc) error
+	Pause(ctx context.Context, chatId int64, until time.Time, sendFunc SendFunc) error
+	Resume(ctx context.Context, chatId int64, sendFunc SendFunc) error
+	RescheduleExisting(ctx context.Context, sendFunc SendFunc) error
+	Reschedule(ctx context.Context, chatId int64)
 }
 
 type SubscriptionRepository interface {
-	Get(ctx context.Context, chatId int64) (sub domain.Subscription, err error)
+	Get(ctx context.Context, id int64) (sub domain.Subscription, err error)
+	GetByChat(ctx context.Context, chatId int64) (subs []domain.Subscription, err error)
 	GetAll(ctx context.Context) (subs []domain.Subscription, err error)
-	Create(ctx context.Context, sub domain.Subscription) error
-	Delete(ctx context.Context, chatId int64) error
+	Create(ctx context.Context, sub domain.Subscription) (id int64, err error)
+	SetPaused(ctx context.Context, id int64, paused bool, until int64) error
+	SetFilter(ctx context.Context, id int64, filter domain.CategoryFilter) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type ChatRepository interface {
+	Get(ctx context.Context, chatId int64) (chat domain.Chat, err error)
 }
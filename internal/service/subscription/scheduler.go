@@ -0,0 +1,332 @@
+package subscription
+
+import (
+	"apubot/internal/domain"
+	"apubot/pkg/utils/clock"
+	"container/heap"
+	"context"
+	"github.com/pkg/errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const lagReportInterval = time.Minute
+
+type (
+	job struct {
+		sub       domain.Subscription
+		nextRun   time.Time
+		failCount int
+		sendFunc  SendFunc
+		index     int // position in heap, -1 while job is being executed
+	}
+
+	// jobHeap is a min-heap of jobs ordered by their next run time.
+	jobHeap []*job
+
+	// scheduler keeps every subscription in a single heap and fires them
+	// from one dispatcher goroutine, sends are executed by a fixed pool of workers.
+	scheduler struct {
+		clock  clock.Clock
+		mu     sync.Mutex
+		jobs   jobHeap
+		byId   map[int64]*job
+		tasks  chan *job
+		wakeup chan struct{}
+		exec   func(ctx context.Context, j *job)
+
+		done    chan struct{} // closed to stop dispatching
+		workers sync.WaitGroup
+
+		// jobsCtx is the parent of send contexts, it is cancelled when running jobs do not stop in time
+		jobsCtx    context.Context
+		cancelJobs context.CancelFunc
+	}
+)
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool { return h[i].nextRun.Before(h[j].nextRun) }
+
+func (h jobHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *jobHeap) Push(x any) {
+	j := x.(*job)
+	j.index = len(*h)
+	*h = append(*h, j)
+}
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	j.index = -1
+	*h = old[:n-1]
+
+	return j
+}
+
+func newScheduler(clk clock.Clock, workers int, exec func(ctx context.Context, j *job)) *scheduler {
+	s := &scheduler{
+		clock:  clk,
+		byId:   make(map[int64]*job),
+		tasks:  make(chan *job),
+		wakeup: make(chan struct{}, 1),
+		exec:   exec,
+		done:   make(chan struct{}),
+	}
+
+	s.jobsCtx, s.cancelJobs = context.WithCancel(context.Background())
+
+	for i := 0; i < workers; i++ {
+		s.workers.Add(1)
+		go s.work()
+	}
+
+	go s.dispatch()
+	go s.reportLag()
+
+	return s
+}
+
+func (s *scheduler) dispatch() {
+	defer close(s.tasks)
+
+	timer := s.clock.NewTimer(time.Hour)
+
+	for {
+		s.mu.Lock()
+
+		if len(s.jobs) > 0 && !s.jobs[0].nextRun.After(s.clock.Now()) {
+			j := heap.Pop(&s.jobs).(*job)
+			s.mu.Unlock()
+
+			// blocks while all workers are busy, the job is dropped on stop as it is restored from db on start
+			select {
+			case s.tasks <- j:
+			case <-s.done:
+				return
+			}
+
+			continue
+		}
+
+		wait := time.Hour
+		if len(s.jobs) > 0 {
+			wait = s.clock.Until(s.jobs[0].nextRun)
+		}
+
+		s.mu.Unlock()
+
+		timer.Reset(wait)
+
+		select {
+		case <-timer.C():
+		case <-s.wakeup:
+			timer.Stop()
+		case <-s.done:
+			timer.Stop()
+
+			return
+		}
+	}
+}
+
+// stop makes dispatcher hand out no more jobs and waits until workers finish the running ones,
+// jobs still running when ctx is done are cancelled.
+func (s *scheduler) stop(ctx context.Context) error {
+	close(s.done)
+	defer s.cancelJobs()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "scheduled sends are still running")
+	}
+}
+
+func (s *scheduler) work() {
+	defer s.workers.Done()
+	for j := range s.tasks {
+		// subscription could be deleted while the job was waiting for a worker
+		if !s.isCurrent(j) {
+			continue
+		}
+
+		s.exec(s.jobsCtx, j)
+	}
+}
+
+func (s *scheduler) notify() {
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// add schedules the job replacing any job already registered for the same subscription.
+func (s *scheduler) add(j *job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeLocked(j.sub.Id)
+
+	s.byId[j.sub.Id] = j
+	heap.Push(&s.jobs, j)
+
+	s.notify()
+}
+
+// requeue puts an executed job back into the heap unless it was removed or replaced meanwhile.
+func (s *scheduler) requeue(j *job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.byId[j.sub.Id] != j {
+		return
+	}
+
+	heap.Push(&s.jobs, j)
+
+	s.notify()
+}
+
+func (s *scheduler) remove(id int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removeLocked(id)
+}
+
+func (s *scheduler) removeLocked(id int64) bool {
+	j, ok := s.byId[id]
+	if !ok {
+		return false
+	}
+
+	if j.index >= 0 {
+		heap.Remove(&s.jobs, j.index)
+	}
+
+	delete(s.byId, id)
+
+	return true
+}
+
+func (s *scheduler) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs = nil
+	s.byId = make(map[int64]*job)
+}
+
+func (s *scheduler) has(id int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.byId[id]
+
+	return ok
+}
+
+// chatJobs returns jobs of every subscription of the chat.
+func (s *scheduler) chatJobs(chatId int64) []*job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []*job
+	for _, j := range s.byId {
+		if j.sub.ChatId == chatId {
+			jobs = append(jobs, j)
+		}
+	}
+
+	return jobs
+}
+
+// isCurrent reports whether the job is still the one registered for its subscription.
+func (s *scheduler) isCurrent(j *job) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.byId[j.sub.Id] == j
+}
+
+// jobState is a copy of scheduling state of the job, it can be read without holding the lock.
+type jobState struct {
+	nextRun   time.Time
+	failCount int
+	queued    bool // false while the job is being executed
+}
+
+// state returns scheduling state of the subscription, false is returned when it is not scheduled.
+func (s *scheduler) state(id int64) (jobState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.byId[id]
+	if !ok {
+		return jobState{}, false
+	}
+
+	return jobState{nextRun: j.nextRun, failCount: j.failCount, queued: j.index >= 0}, true
+}
+
+func (s *scheduler) stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	st := SchedulerStats{Scheduled: len(s.byId)}
+
+	for _, j := range s.jobs {
+		if j.nextRun.After(now) {
+			continue
+		}
+
+		st.QueueDepth++
+
+		if lag := now.Sub(j.nextRun); lag > st.Lag {
+			st.Lag = lag
+		}
+	}
+
+	return st
+}
+
+func (s *scheduler) reportLag() {
+	ticker := s.clock.NewTicker(lagReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+		case <-s.done:
+			return
+		}
+
+		st := s.stats()
+		if st.QueueDepth == 0 {
+			continue
+		}
+
+		log.Printf(
+			"Scheduler is lagging: %d of %d subscription(s) overdue, max lag %s",
+			st.QueueDepth, st.Scheduled, st.Lag.Round(time.Second),
+		)
+	}
+}
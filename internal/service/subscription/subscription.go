@@ -3,34 +3,46 @@ package subscription
 import (
 	"apubot/internal/config"
 	"apubot/internal/domain"
+	"apubot/internal/infrastructure/webapi/tg_bot"
 	"apubot/pkg/custom_errors"
-	"apubot/pkg/utils/queue"
+	"apubot/pkg/utils/clock"
 	"context"
 	"github.com/pkg/errors"
 	"log"
+	"slices"
 	"sync"
 	"time"
 )
 
 type (
 	Service struct {
-		cfg                  *config.Config
-		repo                 SubscriptionRepository
-		runningSubscriptions map[int64]chan struct{}
-		mu                   sync.RWMutex
+		cfg       *config.Config
+		clock     clock.Clock
+		repo      SubscriptionRepository
+		chatRepo  ChatRepository
+		scheduler *scheduler
+		mu        sync.RWMutex
 	}
 )
 
-func New(cfg *config.Config, repo SubscriptionRepository) *Service {
+func New(cfg *config.Config, clk clock.Clock, repo SubscriptionRepository, chatRepo ChatRepository) *Service {
 	service := &Service{
-		cfg:                  cfg,
-		repo:                 repo,
-		runningSubscriptions: make(map[int64]chan struct{}),
+		cfg:      cfg,
+		clock:    clk,
+		repo:     repo,
+		chatRepo: chatRepo,
 	}
 
+	service.scheduler = newScheduler(clk, cfg.SchedulerWorkers, service.runJob)
+
 	return service
 }
 
+// Stop waits for running scheduled sends and stops scheduling new ones, subscriptions are restored on next start.
+func (s *Service) Stop(ctx context.Context) error {
+	return s.scheduler.stop(ctx)
+}
+
 func (s *Service) getAllFromDB(ctx context.Context) (subs []domain.Subscription, err error) {
 	subs, err = s.repo.GetAll(ctx)
 	if err != nil {
@@ -40,70 +52,177 @@ func (s *Service) getAllFromDB(ctx context.Context) (subs []domain.Subscription,
 	return subs, nil
 }
 
-func (s *Service) startWorker(
+// getChat returns settings of the chat, defaults are used if they can not be read.
+func (s *Service) getChat(ctx context.Context, chatId int64) domain.Chat {
+	chat, err := s.chatRepo.Get(ctx, chatId)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if !errors.As(err, &notFoundErr) {
+			log.Printf("Can not get chat %d settings: %v", chatId, err)
+		}
+
+		return domain.Chat{ChatId: chatId}
+	}
+
+	return chat
+}
+
+// localNow returns current time in the chat time zone, schedules are evaluated in it.
+func (s *Service) localNow(ctx context.Context, chatId int64) time.Time {
+	return s.clock.Now().In(s.getChat(ctx, chatId).Location())
+}
+
+func (s *Service) newJob(
 	sub domain.Subscription,
-	exitChan chan struct{},
-	sendFunc func(chatId int64, q *queue.Queue) error,
-) {
-	passedIntervals := time.Since(sub.SubscribedAtAsUnixTime()) / sub.PeriodAsDurationInSeconds()
-	nextRun := sub.SubscribedAtAsUnixTime().Add((passedIntervals + 1) * sub.PeriodAsDurationInSeconds())
-
-	workerInput := &StartWorkerInput{
-		ChatID:   sub.ChatId,
-		ExitChan: exitChan,
-		Delay:    time.Until(nextRun),
-		Period:   sub.PeriodAsDurationInSeconds(),
-	}
-
-	go s.startSubscription(workerInput, sendFunc)
-}
-
-func (s *Service) startSubscription(
-	inp *StartWorkerInput,
-	sendFunc func(chatId int64, q *queue.Queue) error,
-) {
-	failCount := 0
-	timeout := inp.Delay // initial delay before next scheduled event
-	q := queue.NewQueue(s.cfg.LastSentQueueSize)
-
-	for {
-		select {
-		case <-time.After(timeout):
-		case <-inp.ExitChan:
-			return
+	nextRun time.Time,
+	sendFunc SendFunc,
+) *job {
+	return &job{
+		sub:      sub,
+		nextRun:  nextRun,
+		sendFunc: sendFunc,
+	}
+}
+
+// runJob is executed by scheduler workers when the subscription is due,
+// it is limited by the upload timeout as the image may be sent for the first time.
+func (s *Service) runJob(ctx context.Context, j *job) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.UploadTimeout)
+	defer cancel()
+
+	chatId := j.sub.ChatId
+
+	if j.sub.Paused {
+		s.autoResume(ctx, j)
+
+		return
+	}
+
+	chat := s.getChat(ctx, chatId)
+	now := s.clock.Now().In(chat.Location())
+
+	if chat.QuietHours.Contains(now) {
+		if chat.QuietHours.Policy == domain.QuietPolicySkip {
+			j.nextRun = j.sub.NextRun(now)
+		} else {
+			j.nextRun = chat.QuietHours.End(now)
 		}
 
-		start := time.Now()
+		s.scheduler.requeue(j)
 
-		if failCount >= s.cfg.MaxRetries {
-			log.Printf("Max retries reached for chat %d, auto-deleting subscription!", inp.ChatID)
-			err := s.Delete(context.Background(), inp.ChatID)
-			if err != nil {
-				log.Printf("Can not auto-delete subscription %d: %v", inp.ChatID, err)
-			}
+		return
+	}
 
-			return
+	err := j.sendFunc(ctx, j.sub)
+	if errors.Is(err, context.Canceled) {
+		// scheduler is stopping, the subscription is restored from db on next start
+		return
+	}
+
+	var permanentErr *tg_bot.PermanentError
+	var rateErr *tg_bot.RateLimitedError
+	var notFoundErr *custom_errors.NotFoundError
+
+	switch {
+	case err == nil:
+		j.failCount = 0
+		j.nextRun = j.sub.NextRun(now)
+	case errors.As(err, &notFoundErr):
+		// images of the filtered categories may come back, chat is not at fault
+		log.Printf("Nothing to send to chat %d by subscription %q, skipping: %v", chatId, j.sub.Name, err)
+
+		j.nextRun = j.sub.NextRun(now)
+	case errors.Is(err, context.DeadlineExceeded):
+		// slow network or telegram, chat is not at fault
+		log.Printf("Scheduled message to chat %d timed out, skipping: %v", chatId, err)
+
+		j.nextRun = j.sub.NextRun(now)
+	case errors.As(err, &permanentErr):
+		log.Printf(
+			"Chat %d is unreachable (%s), auto-deleting subscription %q!",
+			chatId, permanentErr.Reason, j.sub.Name,
+		)
+		s.expire(ctx, j)
+
+		return
+	case errors.As(err, &rateErr):
+		// not counted as failure, retry as soon as telegram allows
+		log.Printf("Scheduled message to chat %d is rate limited, retrying in %s", chatId, rateErr.RetryAfter)
+
+		j.nextRun = j.sub.NextRun(now)
+		if retryAt := now.Add(rateErr.RetryAfter); retryAt.Before(j.nextRun) {
+			j.nextRun = retryAt
 		}
+	default:
+		j.failCount++
+		log.Printf(
+			"Can not send scheduled message to chat %d (%d/%d): %v",
+			chatId, j.failCount, s.cfg.MaxRetries, err,
+		)
 
-		err := sendFunc(inp.ChatID, q)
-		timeout = inp.Period - time.Since(start) // schedule next event
-		if err != nil {
-			failCount++
-			log.Printf(
-				"Can not send scheduled message to chat %d (%d/%d): %v",
-				inp.ChatID, failCount, s.cfg.MaxRetries, err,
-			)
+		if j.failCount >= s.cfg.MaxRetries {
+			log.Printf("Max retries reached for chat %d, auto-deleting subscription %q!", chatId, j.sub.Name)
+			s.expire(ctx, j)
 
-			continue
+			return
 		}
 
-		failCount = 0
+		j.nextRun = j.sub.NextRun(now)
 	}
+
+	s.scheduler.requeue(j)
+}
+
+// expire deletes the subscription of the job unless it was replaced by a new one.
+func (s *Service) expire(ctx context.Context, j *job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.scheduler.isCurrent(j) {
+		return
+	}
+
+	err := s.repo.Delete(ctx, j.sub.Id)
+	if err != nil {
+		log.Printf("Can not auto-delete subscription %d: %v", j.sub.Id, err)
+
+		return
+	}
+
+	s.scheduler.remove(j.sub.Id)
+}
+
+// autoResume resumes the subscription of the job once its pause duration is over.
+func (s *Service) autoResume(ctx context.Context, j *job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.scheduler.isCurrent(j) {
+		return
+	}
+
+	err := s.repo.SetPaused(ctx, j.sub.Id, false, 0)
+	if err != nil {
+		log.Printf("Can not auto-resume subscription %d: %v", j.sub.Id, err)
+
+		j.nextRun = s.clock.Now().Add(time.Minute)
+		s.scheduler.requeue(j)
+
+		return
+	}
+
+	sub := j.sub
+	sub.Paused = false
+	sub.PausedUntil = 0
+
+	log.Printf("Pause of subscription %q in chat %d is over, resuming", sub.Name, sub.ChatId)
+
+	s.scheduler.add(s.newJob(sub, sub.NextRun(s.localNow(ctx, sub.ChatId)), j.sendFunc))
 }
 
 func (s *Service) RescheduleExisting(
 	ctx context.Context,
-	sendFunc func(chatId int64, q *queue.Queue) error,
+	sendFunc SendFunc,
 ) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -113,98 +232,262 @@ func (s *Service) RescheduleExisting(
 		return errors.Wrap(err, "can not reschedule existing subscriptions")
 	}
 
-	// kill all running subscriptions
-	for _, ch := range s.runningSubscriptions {
-		ch <- struct{}{}
-		close(ch)
-	}
+	s.scheduler.clear()
 
-	s.runningSubscriptions = make(map[int64]chan struct{}, len(existingSubs))
+	scheduled := 0
 
 	for i := range existingSubs {
-		exitChan := make(chan struct{}, 1)
+		if existingSubs[i].Paused {
+			// job of a paused subscription just resumes it
+			if existingSubs[i].PausedUntil > 0 {
+				s.scheduler.add(s.newJob(existingSubs[i], time.Unix(existingSubs[i].PausedUntil, 0), sendFunc))
+			}
 
-		go s.startWorker(existingSubs[i], exitChan, sendFunc)
+			continue
+		}
 
-		s.runningSubscriptions[existingSubs[i].ChatId] = exitChan
+		now := s.localNow(ctx, existingSubs[i].ChatId)
+		s.scheduler.add(s.newJob(existingSubs[i], existingSubs[i].NextRun(now), sendFunc))
+		scheduled++
 	}
 
-	log.Printf("Rescheduled %d existing subscription(s)!", len(s.runningSubscriptions))
+	log.Printf("Rescheduled %d existing subscription(s)!", scheduled)
 
 	return nil
 }
 
-func (s *Service) Get(ctx context.Context, chatId int64) (sub domain.Subscription, err error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// Get returns subscription of the chat with the given name.
+func (s *Service) Get(ctx context.Context, chatId int64, name string) (sub domain.Subscription, err error) {
+	subs, err := s.List(ctx, chatId)
+	if err != nil {
+		return sub, err
+	}
 
-	_, ok := s.runningSubscriptions[chatId]
-	if !ok {
-		return sub, custom_errors.NewNotFound("can not find subscription")
+	for _, sub = range subs {
+		if sub.Name == name {
+			return sub, nil
+		}
 	}
 
-	sub, err = s.repo.Get(ctx, chatId)
+	return domain.Subscription{}, custom_errors.NewNotFound("can not find subscription")
+}
+
+// List returns every subscription of the chat ordered by creation.
+func (s *Service) List(ctx context.Context, chatId int64) (subs []domain.Subscription, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	subs, err = s.repo.GetByChat(ctx, chatId)
 	if err != nil {
-		return sub, errors.Wrap(err, "can not get subscription")
+		return nil, errors.Wrap(err, "can not get subscriptions")
 	}
 
-	return sub, nil
+	return subs, nil
 }
 
+// Create adds a subscription to the chat, existing subscription with the same name is replaced.
 func (s *Service) Create(
 	ctx context.Context,
 	sub domain.Subscription,
-	sendFunc func(chatId int64, q *queue.Queue) error,
+	sendFunc SendFunc,
 ) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// kill running subscription goroutine if exists
-	exitChanOld, ok := s.runningSubscriptions[sub.ChatId]
-	if ok {
-		exitChanOld <- struct{}{}
-		close(exitChanOld)
+	subs, err := s.repo.GetByChat(ctx, sub.ChatId)
+	if err != nil {
+		return errors.Wrap(err, "can not get subscriptions")
 	}
 
-	err := s.repo.Create(ctx, sub)
+	replaced := slices.ContainsFunc(subs, func(existing domain.Subscription) bool {
+		return existing.Name == sub.Name
+	})
+
+	if !replaced && len(subs) >= s.cfg.MaxSubscriptionsPerChat {
+		return custom_errors.NewLimitExceeded("too many subscriptions in chat")
+	}
+
+	sub.Id, err = s.repo.Create(ctx, sub)
 	if err != nil {
 		return errors.Wrap(err, "can not create subscription")
 	}
 
-	exitChan := make(chan struct{}, 1)
+	if sub.Paused {
+		// job of a paused subscription just resumes it, nothing runs while it is paused without time limit
+		s.scheduler.remove(sub.Id)
+
+		if sub.PausedUntil > 0 {
+			s.scheduler.add(s.newJob(sub, time.Unix(sub.PausedUntil, 0), sendFunc))
+		}
 
-	workerInput := &StartWorkerInput{
-		ChatID:   sub.ChatId,
-		ExitChan: exitChan,
-		Delay:    time.Duration(1) * time.Second,
-		Period:   sub.PeriodAsDurationInSeconds(),
+		return nil
 	}
 
-	go s.startSubscription(workerInput, sendFunc)
+	// periodic subscription sends the first image right away, scheduled one waits for its time
+	nextRun := s.clock.Now().Add(time.Second)
+	if !sub.Schedule.IsZero() {
+		nextRun = sub.NextRun(s.localNow(ctx, sub.ChatId))
+	}
 
-	s.runningSubscriptions[sub.ChatId] = exitChan
+	// replaces running subscription if exists
+	s.scheduler.add(s.newJob(sub, nextRun, sendFunc))
 
 	return nil
 }
 
-func (s *Service) Delete(ctx context.Context, chatId int64) error {
+// Delete removes subscription of the chat by its id.
+func (s *Service) Delete(ctx context.Context, chatId int64, id int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	exitChan, ok := s.runningSubscriptions[chatId]
-	if !ok {
+	sub, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "can not get subscription")
+	}
+
+	if sub.ChatId != chatId {
 		return custom_errors.NewNotFound("can not find subscription")
 	}
 
-	err := s.repo.Delete(ctx, chatId)
+	err = s.repo.Delete(ctx, id)
 	if err != nil {
 		return errors.Wrap(err, "can not delete subscription")
 	}
 
-	exitChan <- struct{}{} // stop running subscription goroutine
-	close(exitChan)
+	s.scheduler.remove(id) // stop running subscription
+
+	return nil
+}
+
+// Pause stops sending scheduled images to the chat but keeps subscription settings.
+// Subscriptions resume themselves at the given time, zero time pauses them until Resume is called.
+func (s *Service) Pause(
+	ctx context.Context,
+	chatId int64,
+	until time.Time,
+	sendFunc SendFunc,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs, err := s.repo.GetByChat(ctx, chatId)
+	if err != nil {
+		return errors.Wrap(err, "can not get subscriptions")
+	}
+
+	if len(subs) == 0 {
+		return custom_errors.NewNotFound("can not find subscription")
+	}
 
-	delete(s.runningSubscriptions, chatId)
+	var pausedUntil int64
+	if !until.IsZero() {
+		pausedUntil = until.Unix()
+	}
+
+	for _, sub := range subs {
+		err = s.repo.SetPaused(ctx, sub.Id, true, pausedUntil)
+		if err != nil {
+			return errors.Wrap(err, "can not pause subscription")
+		}
+
+		if pausedUntil == 0 {
+			s.scheduler.remove(sub.Id)
+
+			continue
+		}
+
+		sub.Paused = true
+		sub.PausedUntil = pausedUntil
+		s.scheduler.add(s.newJob(sub, until, sendFunc))
+	}
 
 	return nil
 }
+
+// Resume restarts every paused subscription of the chat.
+func (s *Service) Resume(
+	ctx context.Context,
+	chatId int64,
+	sendFunc SendFunc,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs, err := s.repo.GetByChat(ctx, chatId)
+	if err != nil {
+		return errors.Wrap(err, "can not get subscriptions")
+	}
+
+	resumed := 0
+	now := s.localNow(ctx, chatId)
+
+	for _, sub := range subs {
+		if !sub.Paused {
+			continue
+		}
+
+		err = s.repo.SetPaused(ctx, sub.Id, false, 0)
+		if err != nil {
+			return errors.Wrap(err, "can not resume subscription")
+		}
+
+		sub.Paused = false
+		sub.PausedUntil = 0
+		s.scheduler.add(s.newJob(sub, sub.NextRun(now), sendFunc))
+		resumed++
+	}
+
+	if resumed == 0 {
+		return custom_errors.NewNotFound("can not find paused subscription")
+	}
+
+	return nil
+}
+
+// SetFilter changes categories of images sent by the subscription.
+func (s *Service) SetFilter(
+	ctx context.Context,
+	sub domain.Subscription,
+	filter domain.CategoryFilter,
+	sendFunc SendFunc,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.repo.SetFilter(ctx, sub.Id, filter)
+	if err != nil {
+		return errors.Wrap(err, "can not update subscription filter")
+	}
+
+	sub.Filter = filter
+
+	switch {
+	case !sub.Paused:
+		s.scheduler.add(s.newJob(sub, sub.NextRun(s.localNow(ctx, sub.ChatId)), sendFunc))
+	case sub.PausedUntil > 0:
+		s.scheduler.add(s.newJob(sub, time.Unix(sub.PausedUntil, 0), sendFunc))
+	}
+
+	return nil
+}
+
+// Reschedule recalculates next runs of the chat subscriptions after its time zone was changed.
+func (s *Service) Reschedule(ctx context.Context, chatId int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.localNow(ctx, chatId)
+
+	for _, j := range s.scheduler.chatJobs(chatId) {
+		if j.sub.Paused {
+			continue
+		}
+
+		s.scheduler.add(s.newJob(j.sub, j.sub.NextRun(now), j.sendFunc))
+	}
+}
+
+// Stats returns the current scheduler load, QueueDepth grows when sends can not keep up.
+func (s *Service) Stats() SchedulerStats {
+	return s.scheduler.stats()
+}
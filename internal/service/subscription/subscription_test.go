@@ -0,0 +1,396 @@
+package subscription
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/webapi/tg_bot"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/utils/clock"
+	"context"
+	"github.com/pkg/errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testChatID = 1
+	testPeriod = time.Hour
+	maxRetries = 3
+
+	waitTimeout = 5 * time.Second
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+type memoryRepo struct {
+	mu     sync.Mutex
+	subs   map[int64]domain.Subscription
+	nextID int64
+}
+
+func newMemoryRepo() *memoryRepo {
+	return &memoryRepo{subs: make(map[int64]domain.Subscription)}
+}
+
+func (r *memoryRepo) Get(ctx context.Context, id int64) (domain.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, ok := r.subs[id]
+	if !ok {
+		return sub, custom_errors.NewNotFound("can not find subscription")
+	}
+
+	return sub, nil
+}
+
+func (r *memoryRepo) GetByChat(ctx context.Context, chatId int64) ([]domain.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var subs []domain.Subscription
+	for _, sub := range r.subs {
+		if sub.ChatId == chatId {
+			subs = append(subs, sub)
+		}
+	}
+
+	return subs, nil
+}
+
+func (r *memoryRepo) GetAll(ctx context.Context) ([]domain.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var subs []domain.Subscription
+	for _, sub := range r.subs {
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
+
+func (r *memoryRepo) Create(ctx context.Context, sub domain.Subscription) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// subscription with the same name is replaced keeping its id, like the sql repository does
+	sub.Id = 0
+	for id, existing := range r.subs {
+		if existing.ChatId == sub.ChatId && existing.Name == sub.Name {
+			sub.Id = id
+		}
+	}
+
+	if sub.Id == 0 {
+		r.nextID++
+		sub.Id = r.nextID
+	}
+
+	r.subs[sub.Id] = sub
+
+	return sub.Id, nil
+}
+
+func (r *memoryRepo) SetPaused(ctx context.Context, id int64, paused bool, until int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub := r.subs[id]
+	sub.Paused = paused
+	sub.PausedUntil = until
+	r.subs[id] = sub
+
+	return nil
+}
+
+func (r *memoryRepo) SetFilter(ctx context.Context, id int64, filter domain.CategoryFilter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub := r.subs[id]
+	sub.Filter = filter
+	r.subs[id] = sub
+
+	return nil
+}
+
+func (r *memoryRepo) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.subs, id)
+
+	return nil
+}
+
+type noChatRepo struct{}
+
+func (noChatRepo) Get(ctx context.Context, chatId int64) (domain.Chat, error) {
+	return domain.Chat{}, custom_errors.NewNotFound("can not find chat")
+}
+
+// sender is a SendFunc returning queued results, nil once they are over, and reporting every call.
+type sender struct {
+	mu      sync.Mutex
+	results []error
+	calls   chan time.Time
+	clock   clock.Clock
+}
+
+func newSender(clk clock.Clock, results ...error) *sender {
+	return &sender{results: results, calls: make(chan time.Time, 16), clock: clk}
+}
+
+func (s *sender) send(ctx context.Context, sub domain.Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls <- s.clock.Now()
+
+	if len(s.results) == 0 {
+		return nil
+	}
+
+	err := s.results[0]
+	s.results = s.results[1:]
+
+	return err
+}
+
+func newTestService(t *testing.T, clk *clock.Fake, repo *memoryRepo) *Service {
+	t.Helper()
+
+	s := New(&config.Config{
+		UploadTimeout:           time.Minute,
+		MaxRetries:              maxRetries,
+		MaxSubscriptionsPerChat: 5,
+		SchedulerWorkers:        1,
+	}, clk, repo, noChatRepo{})
+
+	t.Cleanup(func() {
+		_ = s.Stop(context.Background())
+	})
+
+	return s
+}
+
+// subscribe creates a periodic subscription, its first image is due in a second.
+func subscribe(t *testing.T, s *Service, clk *clock.Fake, sendFunc SendFunc) int64 {
+	t.Helper()
+
+	sub := domain.Subscription{
+		ChatId:    testChatID,
+		Name:      domain.DefaultSubscriptionName,
+		CreatedAt: clk.Now().Unix(),
+		Period:    int(testPeriod.Seconds()),
+	}
+
+	err := s.Create(context.Background(), sub, sendFunc)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	subs, _ := s.List(context.Background(), testChatID)
+
+	return subs[0].Id
+}
+
+// runNext advances the clock to the next run of the subscription and waits until it is sent and scheduled again.
+// Returns the time of the send and state of the job scheduled after it, false means the subscription was dropped.
+func runNext(t *testing.T, s *Service, clk *clock.Fake, snd *sender, id int64) (time.Time, jobState, bool) {
+	t.Helper()
+
+	st, ok := s.scheduler.state(id)
+	if !ok {
+		t.Fatal("subscription is not scheduled")
+	}
+
+	clk.Advance(clk.Until(st.nextRun))
+
+	var sentAt time.Time
+
+	select {
+	case sentAt = <-snd.calls:
+	case <-time.After(waitTimeout):
+		t.Fatal("subscription was not sent")
+	}
+
+	deadline := time.Now().Add(waitTimeout)
+
+	for time.Now().Before(deadline) {
+		st, ok = s.scheduler.state(id)
+		if !ok || st.queued {
+			return sentAt, st, ok
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatal("subscription was not scheduled again")
+
+	return sentAt, jobState{}, false
+}
+
+func TestPeriodicSubscriptionRunsEveryPeriod(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	s := newTestService(t, clk, newMemoryRepo())
+	snd := newSender(clk)
+
+	id := subscribe(t, s, clk, snd.send)
+
+	wantSends := []time.Time{
+		testStart.Add(time.Second),
+		testStart.Add(testPeriod),
+		testStart.Add(2 * testPeriod),
+	}
+
+	for i, want := range wantSends {
+		sentAt, st, _ := runNext(t, s, clk, snd, id)
+
+		if !sentAt.Equal(want) {
+			t.Errorf("send %d at %s, want %s", i, sentAt, want)
+		}
+
+		if next := testStart.Add(time.Duration(i+1) * testPeriod); !st.nextRun.Equal(next) {
+			t.Errorf("after send %d next run is %s, want %s", i, st.nextRun, next)
+		}
+	}
+}
+
+func TestFailedSendsAreCountedUntilSubscriptionIsDeleted(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	repo := newMemoryRepo()
+	s := newTestService(t, clk, repo)
+
+	failures := make([]error, maxRetries)
+	for i := range failures {
+		failures[i] = &tg_bot.TransientError{Err: errors.New("bad gateway")}
+	}
+
+	snd := newSender(clk, failures...)
+	id := subscribe(t, s, clk, snd.send)
+
+	for i := 1; i < maxRetries; i++ {
+		_, st, ok := runNext(t, s, clk, snd, id)
+		if !ok {
+			t.Fatalf("subscription deleted after %d failure(s), want %d", i, maxRetries)
+		}
+
+		if st.failCount != i {
+			t.Errorf("failCount = %d, want %d", st.failCount, i)
+		}
+	}
+
+	_, _, ok := runNext(t, s, clk, snd, id)
+	if ok {
+		t.Fatalf("subscription kept after %d failures", maxRetries)
+	}
+
+	if _, err := repo.Get(context.Background(), id); err == nil {
+		t.Error("subscription is not deleted from db")
+	}
+}
+
+func TestSkippedSendsAreNotCounted(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantRun time.Duration // next run after the failed send at one second after start
+	}{
+		{
+			name:    "rate limited",
+			err:     &tg_bot.RateLimitedError{RetryAfter: 30 * time.Second, Err: errors.New("too many requests")},
+			wantRun: time.Second + 30*time.Second,
+		},
+		{
+			name:    "no images match the filter",
+			err:     custom_errors.NewNotFound("no images match the filter"),
+			wantRun: testPeriod,
+		},
+		{
+			name:    "timed out",
+			err:     &tg_bot.TransientError{Err: context.DeadlineExceeded},
+			wantRun: testPeriod,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(testStart)
+			s := newTestService(t, clk, newMemoryRepo())
+
+			failures := make([]error, maxRetries)
+			for i := range failures {
+				failures[i] = tt.err
+			}
+
+			snd := newSender(clk, failures...)
+			id := subscribe(t, s, clk, snd.send)
+
+			_, st, ok := runNext(t, s, clk, snd, id)
+			if !ok {
+				t.Fatal("subscription deleted after the first skipped send")
+			}
+
+			if want := testStart.Add(tt.wantRun); !st.nextRun.Equal(want) {
+				t.Errorf("next run is %s, want %s", st.nextRun, want)
+			}
+
+			for i := 1; i < maxRetries; i++ {
+				_, st, ok = runNext(t, s, clk, snd, id)
+				if !ok {
+					t.Fatalf("subscription deleted after %d skipped sends", i+1)
+				}
+			}
+
+			if st.failCount != 0 {
+				t.Errorf("failCount = %d, want 0", st.failCount)
+			}
+		})
+	}
+}
+
+func TestUnreachableChatSubscriptionIsDeletedAtOnce(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	repo := newMemoryRepo()
+	s := newTestService(t, clk, repo)
+
+	blocked := &tg_bot.PermanentError{Reason: "bot was blocked by the user", Err: errors.New("forbidden")}
+	snd := newSender(clk, blocked)
+	id := subscribe(t, s, clk, snd.send)
+
+	_, _, ok := runNext(t, s, clk, snd, id)
+	if ok {
+		t.Fatal("subscription of unreachable chat is kept")
+	}
+
+	if _, err := repo.Get(context.Background(), id); err == nil {
+		t.Error("subscription is not deleted from db")
+	}
+}
+
+func TestPausedSubscriptionIsNotRunOnReplace(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	s := newTestService(t, clk, newMemoryRepo())
+	snd := newSender(clk)
+
+	id := subscribe(t, s, clk, snd.send)
+
+	sub, err := s.Get(context.Background(), testChatID, domain.DefaultSubscriptionName)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	sub.Paused = true
+
+	err = s.Create(context.Background(), sub, snd.send)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if _, ok := s.scheduler.state(id); ok {
+		t.Error("subscription paused without time limit is scheduled")
+	}
+}
@@ -0,0 +1,516 @@
+package testutil
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FakeBotToken is the token FakeBotAPI accepts, requests with other tokens get 401.
+	FakeBotToken = "123456:fake-token"
+
+	// maxPollWait caps long polling, so bots under test notice shutdown quickly.
+	maxPollWait = time.Second
+
+	// file id prefixes of real telegram ids, they encode the type of the file
+	photoFileIDPrefix     = "AgACAgIAAxkBAAI"
+	animationFileIDPrefix = "CgACAgIAAxkBAAI"
+	documentFileIDPrefix  = "BQACAgIAAxkBAAI"
+	videoFileIDPrefix     = "BAACAgIAAxkBAAI"
+)
+
+var photoSizes = []int{90, 320, 800}
+
+type (
+	// Call is a request received by FakeBotAPI.
+	Call struct {
+		Method string
+		ChatID int64
+		Params map[string]string // form fields except uploaded files
+		Upload string            // name of the uploaded file, empty when the file was sent by file_id
+		FileID string            // file_id the sent file is known by
+	}
+
+	// FakeBotAPI is an in-process Bot API server recording calls of the bot,
+	// bot client is pointed to it with Endpoint and FakeBotToken.
+	FakeBotAPI struct {
+		server *httptest.Server
+
+		mu         sync.Mutex
+		calls      []Call
+		callsAdded chan struct{} // closed and replaced on every call
+		failures   map[string][]tgbotapi.APIResponse
+		blocked    map[int64]bool
+		fileKinds  map[string]string // file_id -> type of sent file
+		messageIDs map[int64]int     // chat id -> last message id
+		seq        int               // source of file and callback ids
+
+		updates      []tgbotapi.Update
+		updatesAdded chan struct{} // closed and replaced on every pushed update
+		nextUpdateID int
+	}
+)
+
+func NewFakeBotAPI() *FakeBotAPI {
+	f := &FakeBotAPI{
+		callsAdded:   make(chan struct{}),
+		failures:     make(map[string][]tgbotapi.APIResponse),
+		blocked:      make(map[int64]bool),
+		fileKinds:    make(map[string]string),
+		messageIDs:   make(map[int64]int),
+		updatesAdded: make(chan struct{}),
+		nextUpdateID: 1,
+	}
+
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+
+	return f
+}
+
+// Endpoint returns the value for config api_endpoint.
+func (f *FakeBotAPI) Endpoint() string {
+	return f.server.URL + "/bot%s/%s"
+}
+
+func (f *FakeBotAPI) Close() {
+	f.server.Close()
+}
+
+// Calls returns recorded calls of the methods in order they were made, every call is returned if none given.
+func (f *FakeBotAPI) Calls(methods ...string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.callsLocked(methods)
+}
+
+func (f *FakeBotAPI) callsLocked(methods []string) []Call {
+	var calls []Call
+
+	for _, call := range f.calls {
+		if len(methods) == 0 || slices.Contains(methods, call.Method) {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// WaitCalls waits until at least n calls of the methods are recorded and returns them,
+// false is returned when timeout expires earlier.
+func (f *FakeBotAPI) WaitCalls(n int, timeout time.Duration, methods ...string) ([]Call, bool) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		f.mu.Lock()
+		calls := f.callsLocked(methods)
+		added := f.callsAdded
+		f.mu.Unlock()
+
+		if len(calls) >= n {
+			return calls, true
+		}
+
+		select {
+		case <-added:
+		case <-deadline.C:
+			return calls, false
+		}
+	}
+}
+
+// FailNext makes the next call of the method fail with the telegram error.
+func (f *FakeBotAPI) FailNext(method string, code int, description string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures[method] = append(f.failures[method], tgbotapi.APIResponse{
+		ErrorCode:   code,
+		Description: description,
+	})
+}
+
+// RateLimitNext makes the next call of the method fail with 429 asking to retry after the delay.
+func (f *FakeBotAPI) RateLimitNext(method string, retryAfter time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	seconds := int(retryAfter.Seconds())
+
+	f.failures[method] = append(f.failures[method], tgbotapi.APIResponse{
+		ErrorCode:   http.StatusTooManyRequests,
+		Description: "Too Many Requests: retry after " + strconv.Itoa(seconds),
+		Parameters:  &tgbotapi.ResponseParameters{RetryAfter: seconds},
+	})
+}
+
+// Block makes every request to the chat fail with 403 as if the bot was blocked by the user.
+func (f *FakeBotAPI) Block(chatID int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.blocked[chatID] = true
+}
+
+// PushUpdate queues the update for getUpdates, update id is assigned automatically.
+func (f *FakeBotAPI) PushUpdate(update tgbotapi.Update) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	update.UpdateID = f.nextUpdateID
+	f.nextUpdateID++
+
+	f.updates = append(f.updates, update)
+
+	close(f.updatesAdded)
+	f.updatesAdded = make(chan struct{})
+}
+
+// PushMessage queues a text message sent to the chat by the user with the same id,
+// negative ids are group chats where the message comes from user 1.
+// Text starting with "/" is marked as a command.
+func (f *FakeBotAPI) PushMessage(chatID int64, text string) {
+	chat := &tgbotapi.Chat{ID: chatID, Type: "private"}
+	from := &tgbotapi.User{ID: chatID, FirstName: "User", LanguageCode: "en"}
+
+	if chatID < 0 {
+		chat.Type = "group"
+		from.ID = 1
+	}
+
+	message := &tgbotapi.Message{
+		MessageID: f.nextMessageID(chatID),
+		From:      from,
+		Chat:      chat,
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+
+	if strings.HasPrefix(text, "/") {
+		command, _, _ := strings.Cut(text, " ")
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(command)}}
+	}
+
+	f.PushUpdate(tgbotapi.Update{Message: message})
+}
+
+// PushCallback queues a press of the inline keyboard button with the data on the message sent by the bot.
+func (f *FakeBotAPI) PushCallback(chatID int64, messageID int, data string) {
+	f.PushUpdate(tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:   strconv.Itoa(f.nextSeq()),
+			From: &tgbotapi.User{ID: chatID, FirstName: "User"},
+			Message: &tgbotapi.Message{
+				MessageID: messageID,
+				Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+			},
+			Data: data,
+		},
+	})
+}
+
+func (f *FakeBotAPI) nextMessageID(chatID int64) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.messageIDs[chatID]++
+
+	return f.messageIDs[chatID]
+}
+
+func (f *FakeBotAPI) nextSeq() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+
+	return f.seq
+}
+
+func (f *FakeBotAPI) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	token, method := path.Split(strings.TrimPrefix(r.URL.Path, "/bot"))
+	if strings.TrimSuffix(token, "/") != FakeBotToken {
+		writeResponse(w, tgbotapi.APIResponse{ErrorCode: http.StatusUnauthorized, Description: "Unauthorized"})
+
+		return
+	}
+
+	call, upload, err := readCall(r, method)
+	if err != nil {
+		writeResponse(w, tgbotapi.APIResponse{ErrorCode: http.StatusBadRequest, Description: err.Error()})
+
+		return
+	}
+
+	if method == "getUpdates" {
+		f.getUpdates(w, r, call)
+
+		return
+	}
+
+	writeResponse(w, f.handle(call, upload))
+}
+
+// readCall parses form of the request, upload is the form field of the uploaded file.
+func readCall(r *http.Request, method string) (call Call, upload string, err error) {
+	call = Call{Method: method, Params: make(map[string]string)}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err = r.ParseMultipartForm(32 << 20)
+	} else {
+		err = r.ParseForm()
+	}
+
+	if err != nil {
+		return call, "", err
+	}
+
+	for key, values := range r.Form {
+		call.Params[key] = values[0]
+	}
+
+	if r.MultipartForm != nil {
+		for field, headers := range r.MultipartForm.File {
+			upload = field
+			call.Upload = headers[0].Filename
+		}
+	}
+
+	if chatID, ok := call.Params["chat_id"]; ok {
+		call.ChatID, _ = strconv.ParseInt(chatID, 10, 64)
+	}
+
+	return call, upload, nil
+}
+
+// handle records the call and builds the response to it.
+func (f *FakeBotAPI) handle(call Call, upload string) tgbotapi.APIResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	defer func() {
+		f.calls = append(f.calls, call)
+
+		close(f.callsAdded)
+		f.callsAdded = make(chan struct{})
+	}()
+
+	if queue := f.failures[call.Method]; len(queue) > 0 {
+		f.failures[call.Method] = queue[1:]
+
+		return queue[0]
+	}
+
+	if call.ChatID != 0 && f.blocked[call.ChatID] {
+		return tgbotapi.APIResponse{
+			ErrorCode:   http.StatusForbidden,
+			Description: "Forbidden: bot was blocked by the user",
+		}
+	}
+
+	var result any
+
+	switch call.Method {
+	case "getMe":
+		result = tgbotapi.User{ID: 1000, IsBot: true, FirstName: "Fake", UserName: "fake_bot"}
+	case "sendMessage", "editMessageText":
+		message := f.newMessageLocked(call)
+		message.Text = call.Params["text"]
+		result = message
+	case "sendPhoto", "sendDocument", "sendVideo":
+		field := strings.ToLower(strings.TrimPrefix(call.Method, "send"))
+
+		message, err := f.fileMessageLocked(&call, field, upload == field)
+		if err != nil {
+			return tgbotapi.APIResponse{ErrorCode: http.StatusBadRequest, Description: err.Error()}
+		}
+
+		result = message
+	default:
+		// setMyCommands, answerCallbackQuery, setWebhook, deleteWebhook and the like
+		result = true
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return tgbotapi.APIResponse{ErrorCode: http.StatusInternalServerError, Description: err.Error()}
+	}
+
+	return tgbotapi.APIResponse{Ok: true, Result: raw}
+}
+
+func (f *FakeBotAPI) newMessageLocked(call Call) tgbotapi.Message {
+	messageID := 0
+	if id, err := strconv.Atoi(call.Params["message_id"]); err == nil {
+		messageID = id
+	} else {
+		f.messageIDs[call.ChatID]++
+		messageID = f.messageIDs[call.ChatID]
+	}
+
+	return tgbotapi.Message{
+		MessageID: messageID,
+		From:      &tgbotapi.User{ID: 1000, IsBot: true, FirstName: "Fake", UserName: "fake_bot"},
+		Chat:      &tgbotapi.Chat{ID: call.ChatID},
+		Date:      int(time.Now().Unix()),
+	}
+}
+
+// fileMessageLocked builds the message with the sent file like telegram does:
+// photos come in several sizes, gif documents are turned into animations, videos are kept as is.
+// Unknown file ids are refused, as by a server which did not issue them.
+func (f *FakeBotAPI) fileMessageLocked(call *Call, field string, uploaded bool) (tgbotapi.Message, error) {
+	message := f.newMessageLocked(*call)
+
+	kind := field
+	fileID := call.Params[field]
+
+	// local paths are accepted like by a server started with --local
+	if !uploaded && strings.HasPrefix(fileID, "file://") {
+		uploaded = true
+		call.Upload = path.Base(fileID)
+	}
+
+	if uploaded {
+		if field == "document" && strings.EqualFold(path.Ext(call.Upload), ".gif") {
+			kind = "animation"
+		}
+
+		fileID = f.newFileIDLocked(kind)
+		f.fileKinds[fileID] = kind
+	} else {
+		var ok bool
+
+		kind, ok = f.fileKinds[fileID]
+		if !ok {
+			return message, errors.New("Bad Request: wrong file identifier/HTTP URL specified")
+		}
+	}
+
+	call.FileID = fileID
+
+	switch kind {
+	case "photo":
+		for i, size := range photoSizes {
+			id := fileID
+			if i < len(photoSizes)-1 {
+				id = fmt.Sprintf("%s_%d", fileID, size)
+			}
+
+			message.Photo = append(message.Photo, tgbotapi.PhotoSize{
+				FileID:       id,
+				FileUniqueID: uniqueID(id),
+				Width:        size,
+				Height:       size,
+			})
+		}
+	case "animation":
+		message.Animation = &tgbotapi.Animation{FileID: fileID, FileUniqueID: uniqueID(fileID), FileName: call.Upload}
+		message.Document = &tgbotapi.Document{FileID: fileID, FileUniqueID: uniqueID(fileID), FileName: call.Upload}
+	case "video":
+		message.Video = &tgbotapi.Video{FileID: fileID, FileUniqueID: uniqueID(fileID), FileName: call.Upload}
+	default:
+		message.Document = &tgbotapi.Document{FileID: fileID, FileUniqueID: uniqueID(fileID), FileName: call.Upload}
+	}
+
+	return message, nil
+}
+
+// newFileIDLocked returns an id shaped like the ones issued by telegram.
+func (f *FakeBotAPI) newFileIDLocked(kind string) string {
+	f.seq++
+
+	prefix := documentFileIDPrefix
+
+	switch kind {
+	case "photo":
+		prefix = photoFileIDPrefix
+	case "animation":
+		prefix = animationFileIDPrefix
+	case "video":
+		prefix = videoFileIDPrefix
+	}
+
+	sum := sha512.Sum512([]byte(kind + strconv.Itoa(f.seq)))
+
+	return prefix + base64.RawURLEncoding.EncodeToString(sum[:])[:56]
+}
+
+func uniqueID(fileID string) string {
+	sum := sha512.Sum512([]byte(fileID))
+
+	return "AQAD" + base64.RawURLEncoding.EncodeToString(sum[:])[:12]
+}
+
+// getUpdates answers long polling with pushed updates not confirmed by offset yet.
+func (f *FakeBotAPI) getUpdates(w http.ResponseWriter, r *http.Request, call Call) {
+	offset, _ := strconv.Atoi(call.Params["offset"])
+	timeout, _ := strconv.Atoi(call.Params["timeout"])
+
+	wait := min(time.Duration(timeout)*time.Second, maxPollWait)
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	for {
+		f.mu.Lock()
+
+		// updates before offset are confirmed by the bot
+		for len(f.updates) > 0 && f.updates[0].UpdateID < offset {
+			f.updates = f.updates[1:]
+		}
+
+		updates := append([]tgbotapi.Update{}, f.updates...)
+		added := f.updatesAdded
+		f.mu.Unlock()
+
+		if len(updates) > 0 {
+			writeResult(w, updates)
+
+			return
+		}
+
+		select {
+		case <-added:
+		case <-deadline.C:
+			writeResult(w, updates)
+
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		writeResponse(w, tgbotapi.APIResponse{ErrorCode: http.StatusInternalServerError, Description: err.Error()})
+
+		return
+	}
+
+	writeResponse(w, tgbotapi.APIResponse{Ok: true, Result: raw})
+}
+
+func writeResponse(w http.ResponseWriter, res tgbotapi.APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !res.Ok {
+		w.WriteHeader(res.ErrorCode)
+	}
+
+	_ = json.NewEncoder(w).Encode(res)
+}
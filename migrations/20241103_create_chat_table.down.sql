@@ -0,0 +1 @@
+DROP TABLE IF EXISTS chat;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS chat
+(
+    chat_id    INT PRIMARY KEY NOT NULL,
+    status     TEXT            NOT NULL,
+    updated_at BIGINT          NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE subscription DROP COLUMN paused;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE subscription ADD COLUMN paused BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
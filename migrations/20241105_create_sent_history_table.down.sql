@@ -0,0 +1 @@
+DROP TABLE IF EXISTS sent_history;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS sent_history
+(
+    chat_id    INT    NOT NULL,
+    image_name TEXT   NOT NULL,
+    sent_at    BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sent_history_chat_id_sent_at_idx ON sent_history (chat_id, sent_at);
\ No newline at end of file
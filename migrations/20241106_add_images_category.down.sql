@@ -0,0 +1 @@
+ALTER TABLE images DROP COLUMN category;
\ No newline at end of file
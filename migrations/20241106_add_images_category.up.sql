@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN category TEXT NOT NULL DEFAULT '';
\ No newline at end of file
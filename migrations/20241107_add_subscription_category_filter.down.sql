@@ -0,0 +1,2 @@
+ALTER TABLE subscription DROP COLUMN include_categories;
+ALTER TABLE subscription DROP COLUMN exclude_categories;
\ No newline at end of file
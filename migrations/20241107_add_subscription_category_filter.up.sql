@@ -0,0 +1,2 @@
+ALTER TABLE subscription ADD COLUMN include_categories TEXT NOT NULL DEFAULT '';
+ALTER TABLE subscription ADD COLUMN exclude_categories TEXT NOT NULL DEFAULT '';
\ No newline at end of file
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS subscription_old
+(
+    chat_id            INT PRIMARY KEY NOT NULL,
+    created_at         BIGINT          NOT NULL,
+    period             INT             NOT NULL,
+    paused             BOOLEAN         NOT NULL DEFAULT FALSE,
+    include_categories TEXT            NOT NULL DEFAULT '',
+    exclude_categories TEXT            NOT NULL DEFAULT ''
+);
+
+-- only the oldest subscription of each chat is kept
+INSERT INTO subscription_old (chat_id, created_at, period, paused, include_categories, exclude_categories)
+SELECT chat_id, created_at, period, paused, include_categories, exclude_categories
+FROM subscription
+WHERE id IN (SELECT MIN(id) FROM subscription GROUP BY chat_id);
+
+DROP TABLE subscription;
+
+ALTER TABLE subscription_old RENAME TO subscription;
\ No newline at end of file
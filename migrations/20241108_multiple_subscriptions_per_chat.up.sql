@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS subscription_new
+(
+    id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id            INT     NOT NULL,
+    name               TEXT    NOT NULL,
+    created_at         BIGINT  NOT NULL,
+    period             INT     NOT NULL,
+    paused             BOOLEAN NOT NULL DEFAULT FALSE,
+    include_categories TEXT    NOT NULL DEFAULT '',
+    exclude_categories TEXT    NOT NULL DEFAULT '',
+    UNIQUE (chat_id, name)
+);
+
+INSERT INTO subscription_new (chat_id, name, created_at, period, paused, include_categories, exclude_categories)
+SELECT chat_id, 'main', created_at, period, paused, include_categories, exclude_categories
+FROM subscription;
+
+DROP TABLE subscription;
+
+ALTER TABLE subscription_new RENAME TO subscription;
\ No newline at end of file
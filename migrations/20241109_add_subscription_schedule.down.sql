@@ -0,0 +1 @@
+ALTER TABLE subscription DROP COLUMN schedule;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE subscription ADD COLUMN schedule TEXT NOT NULL DEFAULT '';
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE chat DROP COLUMN timezone;
+ALTER TABLE chat DROP COLUMN quiet_from;
+ALTER TABLE chat DROP COLUMN quiet_to;
+ALTER TABLE chat DROP COLUMN quiet_policy;
@@ -0,0 +1,4 @@
+ALTER TABLE chat ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
+ALTER TABLE chat ADD COLUMN quiet_from INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chat ADD COLUMN quiet_to INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chat ADD COLUMN quiet_policy TEXT NOT NULL DEFAULT 'defer';
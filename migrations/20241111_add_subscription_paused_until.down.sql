@@ -0,0 +1 @@
+ALTER TABLE subscription DROP COLUMN paused_until;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE subscription ADD COLUMN paused_until BIGINT NOT NULL DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS dialog_session;
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS dialog_session
+(
+    chat_id    INT PRIMARY KEY NOT NULL,
+    state      TEXT            NOT NULL,
+    data       TEXT            NOT NULL DEFAULT '{}',
+    expires_at BIGINT          NOT NULL
+);
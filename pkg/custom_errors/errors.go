@@ -11,3 +11,15 @@ func (e *NotFoundError) Error() string {
 func NewNotFound(message string) *NotFoundError {
 	return &NotFoundError{Message: message}
 }
+
+type LimitExceededError struct {
+	Message string
+}
+
+func (e *LimitExceededError) Error() string {
+	return e.Message
+}
+
+func NewLimitExceeded(message string) *LimitExceededError {
+	return &LimitExceededError{Message: message}
+}
@@ -0,0 +1,56 @@
+package clock
+
+import "time"
+
+type (
+	// Clock tells time and creates timers, code using it instead of time package can be driven by Fake in tests.
+	Clock interface {
+		Now() time.Time
+		Since(t time.Time) time.Duration
+		Until(t time.Time) time.Duration
+		NewTimer(d time.Duration) Timer
+		NewTicker(d time.Duration) Ticker
+	}
+
+	// Timer is a time.Timer, channel is returned by C as interfaces have no fields.
+	Timer interface {
+		C() <-chan time.Time
+		Stop() bool
+		Reset(d time.Duration) bool
+	}
+
+	// Ticker is a time.Ticker, channel is returned by C as interfaces have no fields.
+	Ticker interface {
+		C() <-chan time.Time
+		Stop()
+	}
+
+	realClock struct{}
+
+	realTimer struct {
+		*time.Timer
+	}
+
+	realTicker struct {
+		*time.Ticker
+	}
+)
+
+// New returns the clock backed by time package.
+func New() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+func (realClock) Until(t time.Time) time.Duration { return time.Until(t) }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
@@ -0,0 +1,168 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Fake is a Clock which moves only when Advance is called,
+	// timers and tickers due by the new time fire in order of their deadlines.
+	Fake struct {
+		mu      sync.Mutex
+		now     time.Time
+		waiters []*fakeWaiter
+	}
+
+	// fakeWaiter is a timer or, with positive period, a ticker of Fake.
+	fakeWaiter struct {
+		clock  *Fake
+		c      chan time.Time
+		at     time.Time
+		period time.Duration
+	}
+
+	fakeTicker struct {
+		*fakeWaiter
+	}
+)
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) Until(t time.Time) time.Duration {
+	return t.Sub(f.Now())
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{clock: f, c: make(chan time.Time, 1)}
+	w.Reset(d)
+
+	return w
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	w := &fakeWaiter{clock: f, c: make(chan time.Time, 1), period: d}
+	w.Reset(d)
+
+	return fakeTicker{w}
+}
+
+// Advance moves the clock forward firing every timer and ticker due by the new time.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+	f.fireLocked()
+}
+
+// Waiters returns the number of active timers and tickers,
+// tests use it to wait until the code under test is blocked on the clock.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.waiters)
+}
+
+func (f *Fake) fireLocked() {
+	sort.SliceStable(f.waiters, func(i, j int) bool {
+		return f.waiters[i].at.Before(f.waiters[j].at)
+	})
+
+	var active []*fakeWaiter
+
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			active = append(active, w)
+
+			continue
+		}
+
+		// like time package, a tick is dropped when the previous one is not received yet
+		select {
+		case w.c <- f.now:
+		default:
+		}
+
+		if w.period > 0 {
+			for !w.at.After(f.now) {
+				w.at = w.at.Add(w.period)
+			}
+
+			active = append(active, w)
+		}
+	}
+
+	f.waiters = active
+}
+
+func (f *Fake) removeLocked(w *fakeWaiter) bool {
+	for i, waiter := range f.waiters {
+		if waiter == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+// Stop deactivates the waiter, like time package since go 1.23 no stale value is received after it.
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+
+	w.drain()
+
+	return w.clock.removeLocked(w)
+}
+
+// Reset makes the waiter fire after d, ticker keeps its period.
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+
+	w.drain()
+	active := w.clock.removeLocked(w)
+
+	w.at = w.clock.now.Add(d)
+	w.clock.waiters = append(w.clock.waiters, w)
+	w.clock.fireLocked()
+
+	return active
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
+
+func (w *fakeWaiter) drain() {
+	select {
+	case <-w.c:
+	default:
+	}
+}
@@ -0,0 +1,25 @@
+package random
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// Rand is a seeded random generator safe for concurrent use,
+// the same seed gives the same sequence, so random choices can be reproduced in tests.
+type Rand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func New(seed int64) *Rand {
+	return &Rand{r: rand.New(rand.NewSource(seed))}
+}
+
+// Intn returns a number in [0, n), it panics if n <= 0.
+func (r *Rand) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.r.Intn(n)
+}
@@ -0,0 +1,212 @@
+package schedule
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]int{
+	"sunday": 0, "sun": 0,
+	"monday": 1, "mon": 1,
+	"tuesday": 2, "tue": 2,
+	"wednesday": 3, "wed": 3,
+	"thursday": 4, "thu": 4,
+	"friday": 5, "fri": 5,
+	"saturday": 6, "sat": 6,
+}
+
+// Schedule tells when events happen, the zero value is an empty schedule.
+// It is a union of cron schedules as "12:30 and 18:00" can not be written as a single cron expression.
+type Schedule struct {
+	spec  string
+	crons []cron.Schedule
+}
+
+// Parse reads a raw cron expression like "0 9 * * 1-5", a descriptor like "@daily"
+// or a time of day spec like "every day at 09:00" or "weekdays at 12:30 and 18:00".
+func Parse(spec string) (Schedule, error) {
+	s := Schedule{spec: strings.Join(strings.Fields(strings.ToLower(spec)), " ")}
+	if s.spec == "" {
+		return Schedule{}, errors.New("empty schedule")
+	}
+
+	if c, err := cron.ParseStandard(s.spec); err == nil {
+		s.crons = []cron.Schedule{c}
+	} else if strings.HasPrefix(s.spec, "@") {
+		return Schedule{}, errors.Wrap(err, "can not parse cron expression")
+	} else {
+		exprs, err := parseTimeOfDay(strings.Fields(strings.ReplaceAll(s.spec, ",", " , ")))
+		if err != nil {
+			return Schedule{}, err
+		}
+
+		for _, expr := range exprs {
+			c, err := cron.ParseStandard(expr)
+			if err != nil {
+				return Schedule{}, errors.Wrap(err, "can not parse cron expression")
+			}
+
+			s.crons = append(s.crons, c)
+		}
+	}
+
+	if s.Next(time.Now()).IsZero() {
+		return Schedule{}, errors.New("schedule never fires")
+	}
+
+	return s, nil
+}
+
+// parseTimeOfDay converts "[every] <days> at <time> [and <time>...]" into cron expressions, one per time.
+func parseTimeOfDay(fields []string) ([]string, error) {
+	i := 0
+	if fields[i] == "every" {
+		i++
+	}
+
+	var days []string
+
+	for ; i < len(fields) && fields[i] != "at"; i++ {
+		token := fields[i]
+
+		switch token {
+		case ",", "and", "on":
+		case "day", "daily":
+			days = append(days, "*")
+		case "weekday", "weekdays":
+			days = append(days, "1-5")
+		case "weekend", "weekends":
+			days = append(days, "0,6")
+		default:
+			day, ok := weekdays[strings.TrimSuffix(token, "s")]
+			if !ok {
+				return nil, fmt.Errorf("unknown day: %s", token)
+			}
+
+			days = append(days, strconv.Itoa(day))
+		}
+	}
+
+	if i == len(fields) {
+		return nil, errors.New("time of day is missing")
+	}
+
+	dayField := "*"
+	if len(days) > 0 && !slices.Contains(days, "*") {
+		dayField = strings.Join(days, ",")
+	}
+
+	var exprs []string
+
+	for i++; i < len(fields); i++ {
+		if fields[i] == "," || fields[i] == "and" {
+			continue
+		}
+
+		t, err := time.Parse("15:04", fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid time of day: %s", fields[i])
+		}
+
+		exprs = append(exprs, fmt.Sprintf("%d %d * * %s", t.Minute(), t.Hour(), dayField))
+	}
+
+	if len(exprs) == 0 {
+		return nil, errors.New("time of day is missing")
+	}
+
+	return exprs, nil
+}
+
+// IsStart reports whether the token could begin a schedule spec.
+func IsStart(token string) bool {
+	token = strings.ToLower(token)
+	if token == "" {
+		return false
+	}
+
+	switch token {
+	case "every", "daily", "day", "weekday", "weekdays", "weekend", "weekends", "at", "on":
+		return true
+	}
+
+	if _, ok := weekdays[strings.TrimSuffix(token, "s")]; ok {
+		return true
+	}
+
+	return token[0] == '@' || token[0] == '*' || (token[0] >= '0' && token[0] <= '9')
+}
+
+// ParsePrefix finds the longest leading part of tokens forming a schedule,
+// returns the schedule and number of tokens it took.
+func ParsePrefix(tokens []string) (Schedule, int, error) {
+	if len(tokens) == 0 || !IsStart(tokens[0]) {
+		return Schedule{}, 0, errors.New("no schedule found")
+	}
+
+	var err error
+
+	for n := len(tokens); n > 0; n-- {
+		var s Schedule
+
+		s, err = Parse(strings.Join(tokens[:n], " "))
+		if err == nil {
+			return s, n, nil
+		}
+	}
+
+	return Schedule{}, 0, err
+}
+
+func (s Schedule) IsZero() bool {
+	return len(s.crons) == 0
+}
+
+// Next returns the first event strictly after the given time in its location,
+// zero time is returned when there is none.
+func (s Schedule) Next(after time.Time) time.Time {
+	var next time.Time
+
+	for _, c := range s.crons {
+		t := c.Next(after)
+		if t.IsZero() {
+			continue
+		}
+
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	return next
+}
+
+// ShortestGap returns the smallest interval between the given number of upcoming events.
+func (s Schedule) ShortestGap(from time.Time, events int) time.Duration {
+	var gap time.Duration
+
+	prev := s.Next(from)
+	for i := 1; i < events && !prev.IsZero(); i++ {
+		next := s.Next(prev)
+		if next.IsZero() {
+			break
+		}
+
+		if d := next.Sub(prev); gap == 0 || d < gap {
+			gap = d
+		}
+
+		prev = next
+	}
+
+	return gap
+}
+
+func (s Schedule) String() string {
+	return s.spec
+}
@@ -1,6 +1,8 @@
 package time_string
 
 import (
+	"github.com/pkg/errors"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -27,3 +29,28 @@ func ShortDur(d time.Duration) string {
 
 	return s
 }
+
+// ParseDur parses a duration like time.ParseDuration, additionally accepting leading days like "2d12h".
+func ParseDur(s string) (time.Duration, error) {
+	rawDays, rest, ok := strings.Cut(s, "d")
+	if !ok {
+		return time.ParseDuration(s)
+	}
+
+	days, err := strconv.Atoi(rawDays)
+	if err != nil || days < 0 {
+		return 0, errors.Errorf("invalid duration: %s", s)
+	}
+
+	d := time.Duration(days) * 24 * time.Hour
+	if rest == "" {
+		return d, nil
+	}
+
+	restDur, err := time.ParseDuration(rest)
+	if err != nil {
+		return 0, err
+	}
+
+	return d + restDur, nil
+}